@@ -0,0 +1,57 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+
+    "github.com/whrit/autoGit/internal/backup"
+    "github.com/whrit/autoGit/internal/config"
+)
+
+// runBackup writes a bundle now for every repo with a backup dir, or restores
+// one with `backup restore <bundle>`.
+func runBackup(args []string) {
+    if len(args) > 0 && args[0] == "restore" {
+        runRestore(args[1:])
+        return
+    }
+    fs := flag.NewFlagSet("backup", flag.ExitOnError)
+    fs.Parse(args)
+
+    cfg, found, err := config.Load()
+    if err != nil { log.Fatalf("config: %v", err) }
+    if !found { log.Fatalf("no config at %s; run --setup first", config.Path()) }
+
+    failed := false
+    for _, rc := range cfg.Repos {
+        if rc.Backup.Dir == "" { continue }
+        file, err := backup.Run(rc)
+        switch {
+        case err != nil:
+            failed = true
+            log.Printf("[ERROR] backup (%s): %v", rc.Path, err)
+        case file == "":
+            fmt.Printf("%s: up to date\n", rc.Path)
+        default:
+            fmt.Printf("%s: wrote %s\n", rc.Path, file)
+        }
+    }
+    if failed { os.Exit(1) }
+}
+
+func runRestore(args []string) {
+    fs := flag.NewFlagSet("backup restore", flag.ExitOnError)
+    repo := fs.String("repo", ".", "Repository to restore autosave refs into")
+    fs.Usage = func() {
+        fmt.Fprintln(fs.Output(), "usage: autoGit backup restore [--repo path] <bundle>")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if fs.NArg() != 1 { fs.Usage(); os.Exit(2) }
+
+    applied, err := backup.Restore(*repo, fs.Arg(0))
+    for _, f := range applied { fmt.Printf("applied %s\n", f) }
+    if err != nil { log.Fatalf("restore: %v", err) }
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/gitops"
+    "github.com/whrit/autoGit/internal/theme"
+)
+
+// runLog prints recent autosaves with their notes for each configured repo.
+func runLog(args []string) {
+    fs := flag.NewFlagSet("log", flag.ExitOnError)
+    repo := fs.String("repo", "", "Only show this repo path (default: all configured repos)")
+    n := fs.Int("n", 20, "Number of autosaves to show per repo")
+    files := fs.Bool("files", false, "List the changed paths recorded for each autosave")
+    fs.Parse(args)
+
+    cfg, found, err := config.Load()
+    if err != nil { log.Fatalf("config: %v", err) }
+    if !found { cfg = config.Default() }
+    t := theme.FromName(cfg.Theme)
+
+    paths := []string{*repo}
+    if *repo == "" {
+        paths = paths[:0]
+        paths = append(paths, cfg.RepoPaths()...)
+    }
+
+    for _, p := range paths {
+        list, err := gitops.Autosaves(p, time.Time{}, *n)
+        if err != nil { log.Printf("[ERROR] %v", err); continue }
+        fmt.Println(theme.Sprintf(t, t.Accent, "%s", p))
+        if len(list) == 0 { fmt.Println(theme.Sprintf(t, t.Dim, "  no autosaves")) }
+        for _, a := range list {
+            fmt.Printf("  %s %s %s %s\n",
+                theme.Sprintf(t, t.Warn, "%.8s", a.Hash),
+                theme.Sprintf(t, t.Dim, "%s", a.When.Local().Format("2006-01-02 15:04")),
+                theme.Sprintf(t, t.Info, "%-9s", a.Note.Reason),
+                fmt.Sprintf("%d files, %d events  %s", len(a.Note.Paths), a.Note.Events, a.Subject))
+            if a.Note.Redirect != "" {
+                fmt.Println(theme.Sprintf(t, t.Dim, "      → %s (%s)", a.Note.Target, a.Note.Redirect))
+            }
+            if *files && len(a.Note.Paths) > 0 {
+                fmt.Println(theme.Sprintf(t, t.Dim, "      %s", strings.Join(a.Note.Paths, "\n      ")))
+            }
+        }
+    }
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+    "context"
     "flag"
     "fmt"
     "log"
     "os"
+    "os/signal"
     "path/filepath"
+    "syscall"
+    "time"
 
     "github.com/whrit/autoGit/internal/agent"
     "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/gitops"
     "github.com/whrit/autoGit/internal/logs"
     "github.com/whrit/autoGit/internal/orchestrator"
     "github.com/whrit/autoGit/internal/theme"
@@ -19,31 +24,51 @@ var (
 )
 
 func main() {
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+        case "log":
+            runLog(os.Args[2:])
+            return
+        case "status":
+            runStatus(os.Args[2:])
+            return
+        case "report":
+            runReport(os.Args[2:])
+            return
+        case "backup":
+            runBackup(os.Args[2:])
+            return
+        }
+    }
+
     var (
         setup  bool
         setTheme string
         addRepo string
+        debug  bool
     )
 
     flag.BoolVar(&setup, "setup", false, "Run interactive setup wizard and save config")
     flag.StringVar(&setTheme, "theme", "", "Override theme: auto|dark|light|mono")
     flag.StringVar(&addRepo, "add-repo", "", "Quick-add a repo path to config and save")
+    flag.BoolVar(&debug, "debug", false, "Enable debug logging")
     flag.Parse()
 
     cfgPath := config.Path()
     cfg, found, err := config.Load()
     if err != nil { log.Fatalf("config: %v", err) }
     if !found { cfg = config.Default() }
+    if err := cfg.Validate(); err != nil { log.Fatalf("config: %v", err) }
 
     if setTheme != "" {
         cfg.Theme = setTheme
     }
+    if debug { cfg.Debug = true }
 
     if addRepo != "" {
         cfg.Repos = append(cfg.Repos, config.DefaultRepo(addRepo))
         if err := config.Save(cfg); err != nil { log.Fatalf("save config: %v", err) }
-        fmt.Printf("Added repo and saved config → %s
-", cfgPath)
+        fmt.Printf("Added repo and saved config → %s\n", cfgPath)
         return
     }
 
@@ -54,8 +79,7 @@ func main() {
             cfg, werr = config.RunWizard(cfg)
             if werr != nil { log.Fatalf("setup aborted: %v", werr) }
             if err := config.Save(cfg); err != nil { log.Fatalf("save config: %v", err) }
-            fmt.Printf("Saved config → %s
-", cfgPath)
+            fmt.Printf("Saved config → %s\n", cfgPath)
             if cfg.InstallLaunchAgent {
                 exe, _ := os.Executable()
                 if err := agent.WriteAndLoadLaunchAgent(cfg, exe); err != nil {
@@ -67,13 +91,32 @@ func main() {
         }
     }
 
+    gitops.Version = version
+
     // Bootstrap logging & theming
     if err := logs.Setup(cfg); err != nil { log.Fatalf("log setup: %v", err) }
     t := theme.FromName(cfg.Theme)
 
-    log.Printf("autoGit %s starting in %s
-", version, filepath.Dir(cfgPath))
+    log.Printf("autoGit %s starting in %s\n", version, filepath.Dir(cfgPath))
+
+    // Run orchestrator (blocks until workers complete or shut down)
+    orchestrator.Run(shutdownContext(), cfg, t)
+}
 
-    // Run orchestrator (blocks until workers complete)
-    orchestrator.Run(cfg, t)
+// shutdownContext is cancelled by the first SIGINT or SIGTERM, which lets
+// workers commit what's pending; a second signal exits at once.
+func shutdownContext() context.Context {
+    ctx, cancel := context.WithCancel(context.Background())
+    sigs := make(chan os.Signal, 2)
+    signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        s := <-sigs
+        log.Printf("[INFO] %v: committing pending changes before exit (signal again to exit now)", s)
+        cancel()
+        s = <-sigs
+        log.Printf("[WARN] %v: exiting without waiting", s)
+        for _, op := range gitops.Abort(time.Second) { log.Printf("[WARN] cut off: %s", op) }
+        os.Exit(1)
+    }()
+    return ctx
 }
\ No newline at end of file
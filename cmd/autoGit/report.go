@@ -0,0 +1,70 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/report"
+)
+
+// runReport prints work sessions reconstructed from autosave history.
+func runReport(args []string) {
+    fs := flag.NewFlagSet("report", flag.ExitOnError)
+    since := fs.String("since", "monday", "Start of the report: weekday, today, yesterday, 7d, 36h or 2006-01-02")
+    format := fs.String("format", "markdown", "Output format: markdown|csv|json")
+    idle := fs.Duration("idle", 0, "Idle gap that ends a session (default: report_idle_gap or 30m)")
+    repo := fs.String("repo", "", "Only report on this repo path")
+    fs.Parse(args)
+
+    cfg, found, err := config.Load()
+    if err != nil { log.Fatalf("config: %v", err) }
+    if !found { cfg = config.Default() }
+
+    from, err := parseSince(*since, time.Now())
+    if err != nil { log.Fatalf("report: %v", err) }
+    gap := *idle
+    if gap == 0 { gap = cfg.ReportIdleGap }
+
+    var paths []string
+    if *repo != "" {
+        paths = []string{*repo}
+    } else {
+        paths = append(paths, cfg.RepoPaths()...)
+    }
+
+    r, err := report.Build(paths, from, gap)
+    if err != nil { log.Fatalf("report: %v", err) }
+    if err := report.Write(os.Stdout, r, *format); err != nil { log.Fatalf("report: %v", err) }
+}
+
+// parseSince understands weekday names (most recent, today included), today,
+// yesterday, Nd / Nh-style durations and YYYY-MM-DD dates, all in local time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+    s = strings.ToLower(strings.TrimSpace(s))
+    midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+    switch s {
+    case "today":
+        return midnight, nil
+    case "yesterday":
+        return midnight.AddDate(0, 0, -1), nil
+    }
+    for wd := time.Sunday; wd <= time.Saturday; wd++ {
+        name := strings.ToLower(wd.String())
+        if s == name || s == name[:3] {
+            back := (int(now.Weekday()) - int(wd) + 7) % 7
+            return midnight.AddDate(0, 0, -back), nil
+        }
+    }
+    if strings.HasSuffix(s, "d") {
+        if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil { return midnight.AddDate(0, 0, -n), nil }
+    }
+    if d, err := time.ParseDuration(s); err == nil { return now.Add(-d), nil }
+    if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil { return t, nil }
+    return time.Time{}, fmt.Errorf("cannot parse --since %q", s)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseSince(t *testing.T) {
+    // a Wednesday
+    now := time.Date(2024, 5, 15, 14, 30, 0, 0, time.Local)
+    day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.Local) }
+    tests := []struct {
+        in   string
+        want time.Time
+    }{
+        {"today", day(15)},
+        {" Yesterday ", day(14)},
+        {"monday", day(13)},
+        {"mon", day(13)},
+        {"wednesday", day(15)},
+        {"thu", day(9)},
+        {"7d", day(8)},
+        {"36h", now.Add(-36 * time.Hour)},
+        {"90m", now.Add(-90 * time.Minute)},
+        {"2024-05-01", day(1)},
+    }
+    for _, tt := range tests {
+        got, err := parseSince(tt.in, now)
+        if err != nil || !got.Equal(tt.want) {
+            t.Errorf("parseSince(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+        }
+    }
+    for _, bad := range []string{"", "someday", "2024-13-01", "d"} {
+        if _, err := parseSince(bad, now); err == nil {
+            t.Errorf("parseSince(%q) accepted", bad)
+        }
+    }
+}
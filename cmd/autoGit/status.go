@@ -0,0 +1,60 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/gitops"
+    "github.com/whrit/autoGit/internal/theme"
+)
+
+// runStatus shows, per configured repo, where the next autosave would go and
+// why, plus the most recent autosave.
+func runStatus(args []string) {
+    fs := flag.NewFlagSet("status", flag.ExitOnError)
+    fs.Parse(args)
+
+    cfg, found, err := config.Load()
+    if err != nil { log.Fatalf("config: %v", err) }
+    if !found { cfg = config.Default() }
+    t := theme.FromName(cfg.Theme)
+
+    for _, rc := range cfg.Repos {
+        fmt.Println(theme.Sprintf(t, t.Accent, "%s", rc.Path))
+        if !gitops.IsGitRepo(rc.Path) {
+            fmt.Println(theme.Sprintf(t, t.Err, "  not a git repo"))
+            continue
+        }
+        h := gitops.ReadHead(rc.Path)
+        where := h.Branch
+        if h.Detached() { where = "detached" }
+        fmt.Printf("  HEAD       %s %s\n", where, theme.Sprintf(t, t.Dim, "%.8s", h.Commit))
+
+        tgt := gitops.TargetFor(rc, h)
+        switch {
+        case tgt.Skip:
+            fmt.Printf("  autosaves  %s %s\n", theme.Sprintf(t, t.Warn, "skipped"), theme.Sprintf(t, t.Dim, "(%s)", tgt.Why))
+        case tgt.Ref != "":
+            fmt.Printf("  autosaves  %s %s\n", theme.Sprintf(t, t.Warn, "→ %s", tgt.Ref), theme.Sprintf(t, t.Dim, "(%s)", tgt.Why))
+        default:
+            fmt.Printf("  autosaves  %s\n", theme.Sprintf(t, t.OK, "→ HEAD"))
+        }
+        fmt.Printf("  changes    %s\n", ternStr(gitops.HasChanges(rc.Path), "uncommitted", "clean"))
+
+        list, err := gitops.Autosaves(rc.Path, time.Time{}, 1)
+        if err != nil || len(list) == 0 {
+            fmt.Println(theme.Sprintf(t, t.Dim, "  last       none"))
+            continue
+        }
+        a := list[0]
+        fmt.Printf("  last       %.8s %s %s\n", a.Hash, a.When.Local().Format("2006-01-02 15:04"), a.Note.Reason)
+        if a.Note.Redirect != "" {
+            fmt.Println(theme.Sprintf(t, t.Dim, "             → %s (%s)", a.Note.Target, a.Note.Redirect))
+        }
+    }
+}
+
+func ternStr(b bool, t, f string) string { if b { return t } ; return f }
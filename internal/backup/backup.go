@@ -0,0 +1,254 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/gitops"
+)
+
+// DefaultKeep is the retention count when backup.keep is unset.
+const DefaultKeep = 10
+
+// bundleName is <repo>-<UTC timestamp>-<full|incr>.bundle, where <repo> is
+// RepoName.
+var bundleName = regexp.MustCompile(`^(.+)-(\d{8}T\d{6}Z)-(full|incr)\.bundle$`)
+
+// Bundle is one backup file.
+type Bundle struct {
+	Path string
+	Repo string
+	Time time.Time
+	Full bool
+}
+
+// Run writes a bundle of rc's autosave refs into rc.Backup.Dir when they moved
+// since the last backup, verifies it and rotates old bundles. Bundles are
+// incremental on top of the previous one; a new full bundle starts a fresh
+// chain once the current chain is half the retention count, so at least one
+// complete chain always survives rotation. It returns the new file, or "".
+func Run(rc config.RepoConfig) (string, error) {
+	dir := ExpandHome(rc.Backup.Dir)
+	if dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	keep := rc.Backup.Keep
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	name := RepoName(rc.Path)
+
+	refs, err := gitops.AutosaveRefs(rc.Path)
+	if err != nil || len(refs) == 0 {
+		return "", err
+	}
+	all, err := List(dir, name)
+	if err != nil {
+		return "", err
+	}
+	chain := lastChain(all)
+
+	full := len(chain) == 0 || len(chain) >= (keep+1)/2
+	var exclude []string
+	if !full {
+		heads, err := gitops.BundleHeads(rc.Path, chain[len(chain)-1].Path)
+		switch {
+		case err != nil:
+			full = true
+		case sameRefs(heads, refs):
+			return "", nil
+		default:
+			for _, sha := range heads {
+				if gitops.ResolveRef(rc.Path, sha) == "" {
+					full = true // history was rewritten; start over
+					break
+				}
+				exclude = append(exclude, sha)
+			}
+		}
+	}
+	if full {
+		exclude = nil
+	}
+
+	names := make([]string, 0, len(refs))
+	for r := range refs {
+		names = append(names, r)
+	}
+	sort.Strings(names)
+
+	kind := "incr"
+	if full {
+		kind = "full"
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.bundle", name, time.Now().UTC().Format("20060102T150405Z"), kind))
+	tmp := file + ".tmp"
+	if err := gitops.BundleCreate(rc.Path, tmp, names, exclude); err != nil {
+		os.Remove(tmp)
+		if strings.Contains(err.Error(), "empty bundle") {
+			return "", nil
+		}
+		return "", err
+	}
+	if err := gitops.BundleVerify(rc.Path, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return "", err
+	}
+	return file, rotate(dir, name, keep)
+}
+
+// Restore applies file to repo, first applying the older bundles of its chain
+// found next to it so an incremental bundle can be restored on its own.
+// It returns the bundles applied, oldest first.
+func Restore(repo, file string) ([]string, error) {
+	chain := []string{file}
+	if m := bundleName.FindStringSubmatch(filepath.Base(file)); m != nil {
+		all, err := List(filepath.Dir(file), m[1])
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range all {
+			if filepath.Base(b.Path) != filepath.Base(file) {
+				continue
+			}
+			start := i
+			for start > 0 && !all[start].Full {
+				start--
+			}
+			chain = chain[:0]
+			for _, c := range all[start : i+1] {
+				chain = append(chain, c.Path)
+			}
+			break
+		}
+	}
+
+	var applied []string
+	for _, f := range chain {
+		if err := gitops.BundleVerify(repo, f); err != nil {
+			return applied, err
+		}
+		heads, err := gitops.BundleHeads(repo, f)
+		if err != nil {
+			return applied, err
+		}
+		refs := make([]string, 0, len(heads))
+		for r := range heads {
+			refs = append(refs, r)
+		}
+		sort.Strings(refs)
+		if err := gitops.FetchBundle(repo, f, refs); err != nil {
+			return applied, err
+		}
+		applied = append(applied, f)
+	}
+	return applied, nil
+}
+
+// List returns the bundles of repo name in dir, oldest first.
+func List(dir, name string) ([]Bundle, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []Bundle
+	for _, e := range entries {
+		m := bundleName.FindStringSubmatch(e.Name())
+		if m == nil || m[1] != name {
+			continue
+		}
+		t, _ := time.Parse("20060102T150405Z", m[2])
+		list = append(list, Bundle{Path: filepath.Join(dir, e.Name()), Repo: m[1], Time: t, Full: m[3] == "full"})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	return list, nil
+}
+
+// RepoName names a repo's bundles after its directory, plus a short hash of
+// its absolute path so repos with the same directory name can share a
+// backup dir without mixing chains.
+func RepoName(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("%s-%x", filepath.Base(path), sum[:4])
+}
+
+// ExpandHome resolves a leading ~/ in p.
+func ExpandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, strings.TrimPrefix(p, "~"))
+	}
+	return p
+}
+
+// rotate deletes whole chains, oldest first, while more than keep bundles
+// exist. The newest chain is never touched.
+func rotate(dir, name string, keep int) error {
+	all, err := List(dir, name)
+	if err != nil {
+		return err
+	}
+	chains := splitChains(all)
+	total := len(all)
+	for total > keep && len(chains) > 1 {
+		for _, b := range chains[0] {
+			if err := os.Remove(b.Path); err != nil {
+				return err
+			}
+		}
+		total -= len(chains[0])
+		chains = chains[1:]
+	}
+	return nil
+}
+
+func splitChains(all []Bundle) [][]Bundle {
+	var chains [][]Bundle
+	for _, b := range all {
+		if b.Full || len(chains) == 0 {
+			chains = append(chains, nil)
+		}
+		chains[len(chains)-1] = append(chains[len(chains)-1], b)
+	}
+	return chains
+}
+
+func lastChain(all []Bundle) []Bundle {
+	chains := splitChains(all)
+	if len(chains) == 0 || !chains[len(chains)-1][0].Full {
+		return nil
+	}
+	return chains[len(chains)-1]
+}
+
+func sameRefs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+// autosave commits content to a.txt on refs/heads/autosave/work.
+func autosave(t *testing.T, root, content string) string {
+	t.Helper()
+	sha := testutil.Commit(t, root, "a.txt", content, content)
+	testutil.Git(t, root, "update-ref", "refs/heads/autosave/work", sha)
+	return sha
+}
+
+func TestRunAndRestore(t *testing.T) {
+	root := testutil.NewRepo(t)
+	rc := config.DefaultRepo(root)
+	rc.Backup = config.BackupConfig{Dir: t.TempDir(), Keep: 10}
+
+	if file, err := Run(rc); err != nil || file != "" {
+		t.Fatalf("Run without autosave refs = %q, %v", file, err)
+	}
+	autosave(t, root, "one")
+	full, err := Run(rc)
+	if err != nil || !strings.HasSuffix(full, "-full.bundle") {
+		t.Fatalf("first Run = %q, %v; want a full bundle", full, err)
+	}
+	if file, err := Run(rc); err != nil || file != "" {
+		t.Errorf("Run with nothing new = %q, %v", file, err)
+	}
+	time.Sleep(1100 * time.Millisecond) // bundle names have second resolution
+	tip := autosave(t, root, "two")
+	incr, err := Run(rc)
+	if err != nil || !strings.HasSuffix(incr, "-incr.bundle") {
+		t.Fatalf("second Run = %q, %v; want an incremental bundle", incr, err)
+	}
+
+	// restoring the incremental bundle applies its full one first
+	into := testutil.NewRepo(t)
+	applied, err := Restore(into, incr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0] != full || applied[1] != incr {
+		t.Errorf("applied %q, want %q then %q", applied, full, incr)
+	}
+	if got := testutil.Git(t, into, "rev-parse", "refs/heads/autosave/work"); got != tip {
+		t.Errorf("restored ref at %s, want %s", got, tip)
+	}
+}
+
+func TestRotateKeepsWholeChains(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"repo-20240501T100000Z-full.bundle",
+		"repo-20240501T110000Z-incr.bundle",
+		"repo-20240502T100000Z-full.bundle",
+		"repo-20240502T110000Z-incr.bundle",
+		"repo-20240502T120000Z-incr.bundle",
+		"repo-20240503T100000Z-full.bundle",
+		"repo-20240503T110000Z-incr.bundle",
+		"other-20240501T100000Z-full.bundle",
+	}
+	for _, n := range names {
+		os.WriteFile(filepath.Join(dir, n), nil, 0o644)
+	}
+	if err := rotate(dir, "repo", 4); err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	// whole chains go, oldest first, until no more than keep are left
+	want := []string{names[7], names[5], names[6]}
+	if strings.Join(left, " ") != strings.Join(want, " ") {
+		t.Errorf("left %q, want %q", left, want)
+	}
+
+	list, err := List(dir, "repo")
+	if err != nil || len(list) != 2 || !list[0].Full || list[1].Full || list[0].Repo != "repo" {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+}
+
+func TestSameDirectoryNamesKeepApart(t *testing.T) {
+	testutil.NewRepo(t) // for the git environment
+	dir := t.TempDir()
+	var names []string
+	for _, parent := range []string{t.TempDir(), t.TempDir()} {
+		root := filepath.Join(parent, "project")
+		os.MkdirAll(root, 0o755)
+		testutil.Git(t, parent, "init", "-q", "project")
+		rc := config.DefaultRepo(root)
+		rc.Backup = config.BackupConfig{Dir: dir, Keep: 1}
+		autosave(t, root, "one")
+		if _, err := Run(rc); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, RepoName(root))
+	}
+	if names[0] == names[1] || !strings.HasPrefix(names[0], "project-") {
+		t.Fatalf("RepoName = %q", names)
+	}
+	for _, name := range names {
+		if list, err := List(dir, name); err != nil || len(list) != 1 {
+			t.Errorf("%s has %d bundles, want 1 (%v)", name, len(list), err)
+		}
+	}
+}
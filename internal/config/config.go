@@ -17,18 +17,73 @@ type RepoConfig struct {
     Path         string        `yaml:"path"`
     Interval     time.Duration `yaml:"interval"`       // 0 disables timer
     Watch        bool          `yaml:"watch"`
+    WatchBackend string        `yaml:"watch_backend"`  // fsnotify|poll|auto (poll when fsnotify fails)
+    PollInterval time.Duration `yaml:"poll_interval"`  // poll backend scan interval (default 2s)
+    PollMethod   string        `yaml:"poll_method"`    // stat|git_status
     DebounceMS   int           `yaml:"debounce_ms"`    // debounce for fs events
     BatchWindow  time.Duration `yaml:"batch_window"`   // accumulate at least this long
     IdleWindow   time.Duration `yaml:"idle_window"`    // or fire when idle this long
+    MaxBatchFiles int          `yaml:"max_batch_files"` // flush at once when a batch reaches this many paths; 0 means no limit
+    MaxBatchBytes int64        `yaml:"max_batch_bytes"` // or when its files add up to this many bytes; 0 means no limit
+    SplitCommits string        `yaml:"split_commits"`  // none|directory|size: one autosave as a series of commits
+    SplitBytes   int64         `yaml:"split_bytes"`    // byte limit per commit with split_commits: size
+    StartupCommit string       `yaml:"startup_commit"` // true|false|prompt: commit changes found on start or wake
+    StormThreshold int         `yaml:"storm_threshold"` // events/sec that count as a bulk operation; 0 disables
+    StormQuiet   time.Duration `yaml:"storm_quiet"`    // quiet period that ends a storm
+    WriteProbe   time.Duration `yaml:"write_probe"`    // files must stay unchanged this long to be staged; 0 disables
     Push         bool          `yaml:"push"`
+    PushNotes    bool          `yaml:"push_notes"`     // also push refs/notes/autogit
     Remote       string        `yaml:"remote"`
     Branch       string        `yaml:"branch"`
+    BranchPolicy string        `yaml:"branch_policy"`  // current|autosave (commit to autosave/<branch>)
+    SkipBranches []string      `yaml:"skip_branches"`  // globs; never autosave on these
+    ProtectedBranches []string `yaml:"protected_branches"` // globs; nil means DefaultProtectedBranches
+    OnProtected  string        `yaml:"on_protected"`   // skip|autosave_branch|shadow|allow
+    OnDetached   string        `yaml:"on_detached"`    // skip|shadow|allow
     Msg          string        `yaml:"msg"`
+    Includes     []string      `yaml:"includes"`       // globs; when set only these paths are watched and staged
     Excludes     []string      `yaml:"excludes"`
+    NoiseProfiles []string     `yaml:"noise_profiles"` // vim|emacs|jetbrains|vscode|macos|office; nil means DefaultNoiseProfiles
+    PathRules    []PathRule    `yaml:"path_rules"`     // per-glob batching overrides; first match wins
+    RuleMatch    []string      `yaml:"-"`              // set by Rule: the rule's globs, narrowing Includes further
+    NestedRepos  string        `yaml:"nested_repos"`   // skip|adopt: clones inside the repo are left alone or get workers of their own
     ParseIgnore  bool          `yaml:"parse_gitignore"`
+    IgnoreEngine string        `yaml:"ignore_engine"`  // builtin|git (git check-ignore coprocess)
     Sign         bool          `yaml:"sign"`
     SignArgs     []string      `yaml:"sign_args"`
     Trailers     map[string]string `yaml:"trailers"`
+    Backup       BackupConfig  `yaml:"backup"`
+}
+
+// PathRule overrides batching for the paths matching its globs, which batch
+// and commit on their own. Unset fields inherit the repo's; a zero window turns
+// that trigger off, so a rule with neither window commits only on the interval.
+type PathRule struct {
+    Match       []string       `yaml:"match"`        // globs, as in includes
+    DebounceMS  *int           `yaml:"debounce_ms,omitempty"`
+    BatchWindow *time.Duration `yaml:"batch_window,omitempty"`
+    IdleWindow  *time.Duration `yaml:"idle_window,omitempty"`
+    Msg         string         `yaml:"msg,omitempty"`
+}
+
+// Rule returns rc as path rule i sees it: the rule's overrides applied and the
+// scope narrowed to the paths matching both the includes and its globs, minus
+// the paths earlier rules claim.
+func (rc RepoConfig) Rule(i int) RepoConfig {
+    r, out := rc.PathRules[i], rc
+    out.RuleMatch, out.PathRules = r.Match, rc.PathRules[:i:i]
+    if r.DebounceMS != nil { out.DebounceMS = *r.DebounceMS }
+    if r.BatchWindow != nil { out.BatchWindow = *r.BatchWindow }
+    if r.IdleWindow != nil { out.IdleWindow = *r.IdleWindow }
+    if r.Msg != "" { out.Msg = r.Msg }
+    return out
+}
+
+// BackupConfig schedules git bundle backups of a repo's autosave refs.
+type BackupConfig struct {
+    Dir      string        `yaml:"dir"`      // empty disables backups; ~/ is expanded
+    Interval time.Duration `yaml:"interval"` // 0 means only on `autoGit backup`
+    Keep     int           `yaml:"keep"`     // bundles retained (default 10)
 }
 
 type Config struct {
@@ -37,6 +92,10 @@ type Config struct {
     LogMaxSize int    `yaml:"log_max_size_mb"`
     LogMaxBackups int `yaml:"log_max_backups"`
     LogMaxAge  int    `yaml:"log_max_age_days"`
+    Debug      bool   `yaml:"debug"` // log suppressed events and other detail
+
+    ReportIdleGap time.Duration `yaml:"report_idle_gap"` // gap that ends a work session in reports
+    ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // time allowed for the final flush on SIGINT/SIGTERM
 
     InstallLaunchAgent bool `yaml:"install_launch_agent"`
     StartIntervalSec   int  `yaml:"start_interval_sec"`
@@ -44,21 +103,53 @@ type Config struct {
     Repos []RepoConfig `yaml:"repos"`
 }
 
+// RepoPaths lists the configured repo paths once each, in config order;
+// subtree-scoped entries may share a path.
+func (c Config) RepoPaths() []string {
+    seen := map[string]bool{}
+    var out []string
+    for _, rc := range c.Repos {
+        if !seen[rc.Path] { seen[rc.Path] = true; out = append(out, rc.Path) }
+    }
+    return out
+}
+
+// DefaultProtectedBranches applies when a repo doesn't list protected_branches.
+// An explicit empty list turns protection off.
+var DefaultProtectedBranches = []string{"main", "master", "release/*"}
+
 // Defaults
 func DefaultRepo(path string) RepoConfig {
     return RepoConfig{
         Path:        path,
         Interval:    0,
         Watch:       true,
+        WatchBackend: "auto",
+        PollInterval: 2 * time.Second,
+        PollMethod:  "stat",
         DebounceMS:  1200,
         BatchWindow: 45 * time.Second,
         IdleWindow:  5 * time.Second,
+        StartupCommit: "true",
+        StormThreshold: 200,
+        StormQuiet:  3 * time.Second,
+        WriteProbe:  500 * time.Millisecond,
         Push:        false,
         Remote:      "origin",
         Branch:      "",
+        BranchPolicy: "current",
+        SkipBranches: nil,
+        ProtectedBranches: append([]string{}, DefaultProtectedBranches...),
+        OnProtected: "autosave_branch",
+        OnDetached:  "shadow",
         Msg:         "autosave: {iso}",
         Excludes:    []string{"**/node_modules/**"},
+        NoiseProfiles: append([]string{}, DefaultNoiseProfiles...),
+        NestedRepos: "skip",
+        SplitCommits: "none",
+        SplitBytes:  50 << 20,
         ParseIgnore: true,
+        IgnoreEngine: "builtin",
         Sign:        false,
         SignArgs:    nil,
         Trailers:    map[string]string{},
@@ -73,6 +164,8 @@ func Default() Config {
         LogMaxSize:    10,
         LogMaxBackups: 3,
         LogMaxAge:     14,
+        ReportIdleGap: 30 * time.Minute,
+        ShutdownTimeout: 10 * time.Second,
         InstallLaunchAgent: false,
         StartIntervalSec:   0,
         Repos:        []RepoConfig{DefaultRepo(".")},
@@ -105,15 +198,19 @@ func Save(c Config) error {
     return os.WriteFile(Path(), b, 0o644)
 }
 
+// Stdin is the one buffered reader over os.Stdin; every prompt reads from it
+// so input buffered for one isn't lost to the next.
+var Stdin = bufio.NewReader(os.Stdin)
+
 // Wizard
 func RunWizard(cfg Config) (Config, error) {
     fmt.Println("▶ autoGit setup wizard")
-    in := bufio.NewScanner(os.Stdin)
 
     ask := func(prompt, def string) string {
         if def != "" { fmt.Printf("? %s [%s]: ", prompt, def) } else { fmt.Printf("? %s: ", prompt) }
-        if !in.Scan() { return def }
-        s := strings.TrimSpace(in.Text()); if s == "" { return def }; return s
+        line, err := Stdin.ReadString('\n')
+        if err != nil && line == "" { return def }
+        s := strings.TrimSpace(line); if s == "" { return def }; return s
     }
 
     cfg.Theme = firstNonEmpty(ask("Theme (auto|dark|light|mono)", cfg.Theme), "auto")
@@ -157,4 +254,5 @@ func yesno(s string) bool { s = strings.ToLower(strings.TrimSpace(s)); return s
 func ternStr(b bool, t, f string) string { if b { return t } ; return f }
 func atoiDefault(s string, d int) int { var n int; if _, err := fmt.Sscanf(s, "%d", &n); err == nil { return n }; return d }
 func parseDurDefault(s string, d time.Duration) time.Duration { if v, err := time.ParseDuration(s); err == nil { return v }; return d }
-func IsTerminal() bool { fi, _ := os.Stdin.Stat(); return (fi.Mode() & fs.ModeCharDevice) != 0 }
\ No newline at end of file
+func IsTerminal() bool { fi, _ := os.Stdin.Stat(); return (fi.Mode() & fs.ModeCharDevice) != 0 }
+func splitAndTrim(s, sep string) []string { var out []string; for _, p := range strings.Split(s, sep) { if p = strings.TrimSpace(p); p != "" { out = append(out, p) } } ; return out }
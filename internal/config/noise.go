@@ -0,0 +1,36 @@
+package config
+
+import "sort"
+
+// NoiseProfiles are gitignore-style patterns for the scratch files editors and
+// operating systems leave next to real work. A leading # is escaped so the
+// pattern isn't read as a comment.
+var NoiseProfiles = map[string][]string{
+    "vim":       {"*.sw[a-p]", "*~", "*.un~", "4913"},
+    "emacs":     {".#*", `\#*#`, "*~"},
+    "jetbrains": {"**/.idea/workspace.xml", "**/.idea/shelf/", "*___jb_tmp___", "*___jb_old___"},
+    "vscode":    {"**/.vscode/ipch/", "**/.history/"},
+    "macos":     {".DS_Store", "._*", ".AppleDouble", ".LSOverride"},
+    "office":    {"~$*", ".~lock.*#", "*.tmp"},
+}
+
+// DefaultNoiseProfiles applies when a repo doesn't list noise_profiles.
+// An explicit empty list turns noise filtering off.
+var DefaultNoiseProfiles = []string{"vim", "emacs", "jetbrains", "vscode", "macos", "office"}
+
+// NoisePatterns returns the patterns of rc's noise profiles, and the profile
+// names it doesn't know.
+func (rc RepoConfig) NoisePatterns() (patterns, unknown []string) {
+    names := rc.NoiseProfiles
+    if names == nil { names = DefaultNoiseProfiles }
+    seen := map[string]bool{}
+    for _, n := range names {
+        list, ok := NoiseProfiles[n]
+        if !ok { unknown = append(unknown, n); continue }
+        for _, p := range list {
+            if !seen[p] { seen[p] = true; patterns = append(patterns, p) }
+        }
+    }
+    sort.Strings(patterns)
+    return patterns, unknown
+}
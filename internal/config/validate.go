@@ -0,0 +1,64 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "slices"
+    "strings"
+)
+
+// choices lists the accepted values of each enumerated repo setting; empty is
+// always accepted and means the default.
+var choices = []struct {
+    key  string
+    get  func(RepoConfig) string
+    opts []string
+}{
+    {"watch_backend", func(rc RepoConfig) string { return rc.WatchBackend }, []string{"fsnotify", "poll", "auto"}},
+    {"poll_method", func(rc RepoConfig) string { return rc.PollMethod }, []string{"stat", "git_status"}},
+    {"startup_commit", func(rc RepoConfig) string { return rc.StartupCommit }, []string{"true", "false", "prompt"}},
+    {"branch_policy", func(rc RepoConfig) string { return rc.BranchPolicy }, []string{"current", "autosave"}},
+    {"on_protected", func(rc RepoConfig) string { return rc.OnProtected }, []string{"skip", "autosave_branch", "shadow", "allow"}},
+    {"on_detached", func(rc RepoConfig) string { return rc.OnDetached }, []string{"skip", "shadow", "allow"}},
+    {"ignore_engine", func(rc RepoConfig) string { return rc.IgnoreEngine }, []string{"builtin", "git"}},
+    {"nested_repos", func(rc RepoConfig) string { return rc.NestedRepos }, []string{"skip", "adopt"}},
+    {"split_commits", func(rc RepoConfig) string { return rc.SplitCommits }, []string{"none", "directory", "size"}},
+}
+
+// Validate reports every setting that can't be used, so a bad edit can be
+// rejected before anything is applied.
+func (c Config) Validate() error {
+    var errs []error
+    if c.ShutdownTimeout < 0 { errs = append(errs, errors.New("shutdown_timeout is negative")) }
+    for i, rc := range c.Repos {
+        where := fmt.Sprintf("repos[%d]", i)
+        if strings.TrimSpace(rc.Path) == "" {
+            errs = append(errs, fmt.Errorf("%s: path is empty", where))
+            continue
+        }
+        where += " (" + rc.Path + ")"
+        for _, ch := range choices {
+            v := ch.get(rc)
+            if v != "" && !slices.Contains(ch.opts, v) {
+                errs = append(errs, fmt.Errorf("%s: %s %q is not one of %s", where, ch.key, v, strings.Join(ch.opts, "|")))
+            }
+        }
+        // listed in order, so the errors come out the same way every time
+        for _, f := range []struct {
+            key string
+            n   int64
+        }{
+            {"interval", int64(rc.Interval)}, {"poll_interval", int64(rc.PollInterval)}, {"batch_window", int64(rc.BatchWindow)},
+            {"idle_window", int64(rc.IdleWindow)}, {"storm_quiet", int64(rc.StormQuiet)}, {"write_probe", int64(rc.WriteProbe)},
+            {"backup.interval", int64(rc.Backup.Interval)}, {"debounce_ms", int64(rc.DebounceMS)}, {"storm_threshold", int64(rc.StormThreshold)},
+            {"max_batch_files", int64(rc.MaxBatchFiles)}, {"max_batch_bytes", rc.MaxBatchBytes}, {"split_bytes", rc.SplitBytes},
+            {"backup.keep", int64(rc.Backup.Keep)},
+        } {
+            if f.n < 0 { errs = append(errs, fmt.Errorf("%s: %s is negative", where, f.key)) }
+        }
+        for j, r := range rc.PathRules {
+            if len(r.Match) == 0 { errs = append(errs, fmt.Errorf("%s: path_rules[%d] has no match globs", where, j)) }
+        }
+    }
+    return errors.Join(errs...)
+}
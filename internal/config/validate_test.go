@@ -0,0 +1,36 @@
+package config
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestValidateReportsInOrder(t *testing.T) {
+    if err := (Config{Repos: []RepoConfig{DefaultRepo("/repo")}}).Validate(); err != nil { t.Fatalf("default repo: %v", err) }
+
+    rc := DefaultRepo("/repo")
+    rc.WatchBackend, rc.SplitCommits = "kqueue", "files"
+    rc.Interval, rc.StormQuiet, rc.Backup.Interval = -time.Second, -time.Second, -time.Second
+    rc.DebounceMS, rc.MaxBatchBytes, rc.Backup.Keep = -1, -1, -1
+    rc.PathRules = []PathRule{{}}
+    c := Config{ShutdownTimeout: -time.Second, Repos: []RepoConfig{rc, {}}}
+    want := []string{
+        "shutdown_timeout is negative",
+        `repos[0] (/repo): watch_backend "kqueue" is not one of fsnotify|poll|auto`,
+        `repos[0] (/repo): split_commits "files" is not one of none|directory|size`,
+        "repos[0] (/repo): interval is negative",
+        "repos[0] (/repo): storm_quiet is negative",
+        "repos[0] (/repo): backup.interval is negative",
+        "repos[0] (/repo): debounce_ms is negative",
+        "repos[0] (/repo): max_batch_bytes is negative",
+        "repos[0] (/repo): backup.keep is negative",
+        "repos[0] (/repo): path_rules[0] has no match globs",
+        "repos[1]: path is empty",
+    }
+    for i := 0; i < 20; i++ {
+        err := c.Validate()
+        if err == nil { t.Fatal("no errors") }
+        if got := err.Error(); got != strings.Join(want, "\n") { t.Fatalf("run %d:\n%s\nwant:\n%s", i, got, strings.Join(want, "\n")) }
+    }
+}
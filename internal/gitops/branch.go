@@ -0,0 +1,136 @@
+package gitops
+
+import (
+    "fmt"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+
+    "github.com/whrit/autoGit/internal/config"
+)
+
+// Head describes what HEAD points at. Branch is empty when detached.
+type Head struct {
+    Branch string
+    Commit string
+}
+
+// Detached reports whether HEAD is not on a branch.
+func (h Head) Detached() bool { return h.Branch == "" }
+
+// GitDir returns the absolute git directory for repo (handles worktrees).
+func GitDir(repo string) (string, error) {
+    out, err := runOut(repo, "git", "rev-parse", "--absolute-git-dir")
+    if err != nil { return "", fmt.Errorf("git rev-parse --absolute-git-dir (%s): %w", repo, err) }
+    return strings.TrimSpace(out), nil
+}
+
+// HeadFile returns the raw contents of gitDir/HEAD. It is cheap enough to
+// poll and changes whenever a checkout moves HEAD to another branch.
+func HeadFile(gitDir string) string {
+    b, _ := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+    return strings.TrimSpace(string(b))
+}
+
+// ReadHead resolves HEAD to its branch and commit.
+func ReadHead(repo string) Head {
+    br, _ := runOut(repo, "git", "symbolic-ref", "-q", "--short", "HEAD")
+    sha, _ := runOut(repo, "git", "rev-parse", "-q", "--verify", "HEAD")
+    return Head{Branch: strings.TrimSpace(br), Commit: strings.TrimSpace(sha)}
+}
+
+// ResolveRef returns the commit ref points at, or "" when it doesn't exist.
+func ResolveRef(repo, ref string) string {
+    out, err := runOut(repo, "git", "rev-parse", "-q", "--verify", ref+"^{commit}")
+    if err != nil { return "" }
+    return strings.TrimSpace(out)
+}
+
+// Switched reports whether moving from old to cur is a checkout rather than
+// a commit on the same line of history.
+func Switched(repo string, old, cur Head) bool {
+    if old.Branch != cur.Branch { return true }
+    if !old.Detached() || old.Commit == cur.Commit { return false }
+    return !IsAncestor(repo, old.Commit, cur.Commit)
+}
+
+// IsAncestor reports whether a is an ancestor of (or equal to) b.
+func IsAncestor(repo, a, b string) bool {
+    if a == "" || b == "" { return false }
+    return mustRun(repo, "git", "merge-base", "--is-ancestor", a, b) == nil
+}
+
+// ChangedBetween lists paths (relative to repo) that differ between two commits.
+func ChangedBetween(repo, a, b string) ([]string, error) {
+    if a == "" || b == "" || a == b { return nil, nil }
+    out, err := runOut(repo, "git", "diff", "--name-only", "--relative", "--no-renames", a, b)
+    if err != nil { return nil, fmt.Errorf("git diff %s %s: %w", a, b, err) }
+    var list []string
+    for _, l := range strings.Split(out, "\n") {
+        if l = strings.TrimSpace(l); l != "" { list = append(list, l) }
+    }
+    return list, nil
+}
+
+// Target is where an autosave goes.
+type Target struct {
+    Ref  string // empty commits on HEAD; otherwise a full ref such as refs/heads/autosave/main
+    Skip bool   // drop the autosave entirely
+    Why  string // set when the autosave is redirected or skipped
+}
+
+// AutosaveRef is the ref that receives autosaves for branch.
+func AutosaveRef(branch string) string { return "refs/heads/autosave/" + branch }
+
+// ShadowRef is a hidden ref (not listed by git branch, never pushed) that
+// keeps autosaves for branch, or for a detached commit, safe from gc.
+func ShadowRef(h Head) string {
+    if h.Detached() { return fmt.Sprintf("refs/autogit/shadow/detached/%.12s", h.Commit) }
+    return "refs/autogit/shadow/" + h.Branch
+}
+
+// TargetFor applies rc's branch, protection and detached-HEAD policies to an
+// autosave of h. Unless rc explicitly opts in with on_protected: allow, the
+// result never commits onto a protected branch.
+func TargetFor(rc config.RepoConfig, h Head) Target {
+    if h.Detached() {
+        switch firstNonEmpty(rc.OnDetached, "shadow") {
+        case "allow":
+            return Target{}
+        case "skip":
+            return Target{Skip: true, Why: "HEAD is detached (on_detached skip)"}
+        default:
+            return Target{Ref: ShadowRef(h), Why: "HEAD is detached (on_detached shadow)"}
+        }
+    }
+    if MatchBranch(rc.SkipBranches, h.Branch) {
+        return Target{Skip: true, Why: fmt.Sprintf("branch %s matches skip_branches", h.Branch)}
+    }
+    protected := rc.ProtectedBranches
+    if protected == nil { protected = config.DefaultProtectedBranches }
+    if MatchBranch(protected, h.Branch) {
+        why := fmt.Sprintf("branch %s is protected (on_protected %s)", h.Branch, firstNonEmpty(rc.OnProtected, "autosave_branch"))
+        switch firstNonEmpty(rc.OnProtected, "autosave_branch") {
+        case "allow":
+        case "skip":
+            return Target{Skip: true, Why: why}
+        case "shadow":
+            return Target{Ref: ShadowRef(h), Why: why}
+        default:
+            return Target{Ref: AutosaveRef(h.Branch), Why: why}
+        }
+    }
+    if rc.BranchPolicy == "autosave" {
+        return Target{Ref: AutosaveRef(h.Branch), Why: "branch_policy autosave"}
+    }
+    return Target{}
+}
+
+// MatchBranch reports whether branch matches any of the glob patterns (e.g. release/*).
+func MatchBranch(patterns []string, branch string) bool {
+    for _, p := range patterns {
+        if ok, _ := path.Match(p, branch); ok { return true }
+    }
+    return false
+}
@@ -0,0 +1,38 @@
+package gitops
+
+import (
+    "testing"
+
+    "github.com/whrit/autoGit/internal/config"
+)
+
+func TestTargetFor(t *testing.T) {
+    work, main := Head{Branch: "work", Commit: "abc"}, Head{Branch: "main", Commit: "abc"}
+    detached := Head{Commit: "0123456789abcdef"}
+    cases := []struct {
+        name string
+        set  func(rc *config.RepoConfig)
+        head Head
+        want Target
+    }{
+        {"plain branch", nil, work, Target{}},
+        {"protected by default", nil, main, Target{Ref: "refs/heads/autosave/main", Why: "branch main is protected (on_protected autosave_branch)"}},
+        {"release glob", nil, Head{Branch: "release/1.2"}, Target{Ref: "refs/heads/autosave/release/1.2", Why: "branch release/1.2 is protected (on_protected autosave_branch)"}},
+        {"protection off", func(rc *config.RepoConfig) { rc.ProtectedBranches = []string{} }, main, Target{}},
+        {"protected shadow", func(rc *config.RepoConfig) { rc.OnProtected = "shadow" }, main, Target{Ref: "refs/autogit/shadow/main", Why: "branch main is protected (on_protected shadow)"}},
+        {"protected skip", func(rc *config.RepoConfig) { rc.OnProtected = "skip" }, main, Target{Skip: true, Why: "branch main is protected (on_protected skip)"}},
+        {"protected allow", func(rc *config.RepoConfig) { rc.OnProtected = "allow" }, main, Target{}},
+        {"skip_branches wins", func(rc *config.RepoConfig) { rc.SkipBranches = []string{"wo*"} }, work, Target{Skip: true, Why: "branch work matches skip_branches"}},
+        {"branch_policy autosave", func(rc *config.RepoConfig) { rc.BranchPolicy = "autosave" }, work, Target{Ref: "refs/heads/autosave/work", Why: "branch_policy autosave"}},
+        {"detached shadow", nil, detached, Target{Ref: "refs/autogit/shadow/detached/0123456789ab", Why: "HEAD is detached (on_detached shadow)"}},
+        {"detached skip", func(rc *config.RepoConfig) { rc.OnDetached = "skip" }, detached, Target{Skip: true, Why: "HEAD is detached (on_detached skip)"}},
+        {"detached allow", func(rc *config.RepoConfig) { rc.OnDetached = "allow" }, detached, Target{}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            rc := config.RepoConfig{}
+            if tc.set != nil { tc.set(&rc) }
+            if got := TargetFor(rc, tc.head); got != tc.want { t.Errorf("got %+v, want %+v", got, tc.want) }
+        })
+    }
+}
@@ -0,0 +1,54 @@
+package gitops
+
+import (
+    "fmt"
+    "strings"
+)
+
+// AutosaveRefPrefixes are the refs autoGit owns and backs up.
+var AutosaveRefPrefixes = []string{"refs/heads/autosave/", "refs/autogit/", NotesRef}
+
+// AutosaveRefs returns the autosave refs of repo and the commits they point at.
+func AutosaveRefs(repo string) (map[string]string, error) {
+    args := append([]string{"for-each-ref", "--format=%(objectname) %(refname)"}, AutosaveRefPrefixes...)
+    out, err := runOut(repo, "git", args...)
+    if err != nil { return nil, fmt.Errorf("git for-each-ref (%s): %w", repo, err) }
+    return parseRefLines(out), nil
+}
+
+// BundleCreate writes a bundle of refs to file, leaving out history already
+// reachable from the commits in exclude.
+func BundleCreate(repo, file string, refs []string, exclude []string) error {
+    args := append([]string{"bundle", "create", "-q", file}, refs...)
+    for _, sha := range exclude { args = append(args, "^"+sha) }
+    return mustRun(repo, "git", args...)
+}
+
+// BundleVerify checks that file is valid and its prerequisites exist in repo.
+func BundleVerify(repo, file string) error {
+    return mustRun(repo, "git", "bundle", "verify", "-q", file)
+}
+
+// BundleHeads lists the refs recorded in a bundle.
+func BundleHeads(repo, file string) (map[string]string, error) {
+    out, err := runOut(repo, "git", "bundle", "list-heads", file)
+    if err != nil { return nil, fmt.Errorf("git bundle list-heads %s: %w", file, err) }
+    return parseRefLines(out), nil
+}
+
+// FetchBundle updates refs of repo from the same refs in file. Refs that
+// would not fast-forward are rejected rather than overwritten.
+func FetchBundle(repo, file string, refs []string) error {
+    args := []string{"fetch", "--no-tags", file}
+    for _, r := range refs { args = append(args, r+":"+r) }
+    return mustRun(repo, "git", args...)
+}
+
+func parseRefLines(out string) map[string]string {
+    refs := map[string]string{}
+    for _, l := range strings.Split(out, "\n") {
+        f := strings.Fields(l)
+        if len(f) == 2 { refs[f[1]] = f[0] }
+    }
+    return refs
+}
@@ -0,0 +1,74 @@
+package gitops
+
+import (
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+// warnedEmbedded remembers which embedded repos were already reported.
+var warnedEmbedded sync.Map
+
+// EmbeddedRepos returns the untracked repositories below repo, relative to it.
+// git add -A would record each of them as a gitlink, which is almost never
+// what an autosave wants.
+func EmbeddedRepos(repo string) []string {
+    paths, err := StatusPaths(repo)
+    if err != nil { return nil }
+    var found []string
+    for p, code := range paths {
+        if code != "??" || !strings.HasSuffix(p, "/") { continue }
+        if _, err := os.Lstat(filepath.Join(repo, filepath.FromSlash(p), ".git")); err == nil {
+            found = append(found, strings.TrimSuffix(p, "/"))
+        }
+    }
+    return found
+}
+
+// embeddedSpecs lists repo's embedded repositories as pathspecs with the given
+// magic, warning once about each.
+func embeddedSpecs(repo, magic string) []string {
+    found := EmbeddedRepos(repo)
+    for _, p := range found {
+        if _, seen := warnedEmbedded.LoadOrStore(filepath.Join(repo, p), true); !seen {
+            log.Printf("[WARN] %s: not staging embedded repository %s; add it as a submodule, ignore it or set nested_repos: adopt", repo, p)
+        }
+    }
+    return literalSpecs(magic, found)
+}
+
+// addFiles stages the changed files matching spec one by one instead of
+// handing spec to git add, which would take in the embedded repos below it
+// (or fail outright on one without commits).
+func addFiles(repo string, env []string, spec string) error {
+    files, err := changedFiles(repo, env, []string{spec})
+    if err != nil { return err }
+    return addPaths(repo, env, files)
+}
+
+// changedFiles lists the untracked, modified and deleted files matching
+// specs, relative to repo; embedded repositories aren't listed.
+func changedFiles(repo string, env []string, specs []string) ([]string, error) {
+    out, err := runEnv(repo, env, append([]string{"ls-files", "-z", "-o", "-m", "-d", "--exclude-standard", "--"}, specs...)...)
+    if err != nil { return nil, err }
+    seen := map[string]bool{}
+    var files []string
+    for _, f := range splitNul(out) {
+        if !seen[f] && !strings.HasSuffix(f, "/") { seen[f] = true; files = append(files, f) }
+    }
+    return files, nil
+}
+
+// addPaths stages files (relative to repo) by name, in chunks that keep the
+// command line short.
+func addPaths(repo string, env []string, files []string) error {
+    specs := literalSpecs("literal", files)
+    for len(specs) > 0 {
+        n := min(len(specs), 500)
+        if _, err := runEnv(repo, env, append([]string{"add", "-A", "--"}, specs[:n]...)...); err != nil { return err }
+        specs = specs[n:]
+    }
+    return nil
+}
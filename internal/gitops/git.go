@@ -3,8 +3,10 @@ package gitops
 import (
     "bytes"
     "fmt"
+    "os"
     "os/exec"
     "path/filepath"
+    "slices"
     "sort"
     "strings"
     "time"
@@ -16,8 +18,8 @@ func mustRun(dir, name string, args ...string) error {
     cmd := exec.Command(name, args...)
     cmd.Dir = dir
     var stderr bytes.Buffer
-    cmd.Stderr &= stderr
-    if err := cmd.Run(); err != nil {
+    cmd.Stderr = &stderr
+    if err := run(cmd); err != nil {
         return fmt.Errorf("%s %s: %w (%s)", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
     }
     return nil
@@ -29,10 +31,18 @@ func runOut(dir, name string, args ...string) (string, error) {
     var stdout, stderr bytes.Buffer
     cmd.Stdout = &stdout
     cmd.Stderr = &stderr
-    err := cmd.Run()
+    err := run(cmd)
     return stdout.String(), err
 }
 
+// Config reads a git config value as seen from repo; typ is a type flag such
+// as --bool or --path. Unset keys yield "".
+func Config(repo, typ, key string) string {
+    out, err := runOut(repo, "git", "config", typ, "--get", key)
+    if err != nil { return "" }
+    return strings.TrimSpace(out)
+}
+
 func IsGitRepo(path string) bool {
     _, err := exec.LookPath("git")
     if err != nil { return false }
@@ -47,59 +57,462 @@ func HasChanges(repo string) bool {
     return strings.TrimSpace(out) != ""
 }
 
+// StatusPaths returns the dirty paths under repo (relative to it, forward
+// slashes) with their two-letter porcelain status, untracked files included.
+// It runs with --no-optional-locks so polling never holds index.lock while
+// an autosave stages or commits.
+func StatusPaths(repo string) (map[string]string, error) {
+    prefix, _ := runOut(repo, "git", "rev-parse", "--show-prefix")
+    prefix = strings.TrimSpace(prefix)
+    out, err := runOut(repo, "git", "--no-optional-locks", "status", "--porcelain=v1", "-z", "--untracked-files=all", "--", ".")
+    if err != nil { return nil, fmt.Errorf("git status (%s): %w", repo, err) }
+    paths := map[string]string{}
+    recs := strings.Split(out, "\x00")
+    for i := 0; i < len(recs); i++ {
+        r := recs[i]
+        if len(r) < 4 { continue }
+        code, p := r[:2], r[3:]
+        if code[0] == 'R' || code[0] == 'C' { i++ } // next record is the source path
+        paths[strings.TrimPrefix(p, prefix)] = code
+    }
+    return paths, nil
+}
+
+// BlobIDs returns the blob id git would record for the working tree content
+// of each path (relative to repo); paths that don't exist map to "" and
+// symlinks to their target.
+func BlobIDs(repo string, paths []string) map[string]string {
+    ids := make(map[string]string, len(paths))
+    var present []string
+    for _, p := range paths {
+        ids[p] = ""
+        abs := filepath.Join(repo, filepath.FromSlash(p))
+        fi, err := os.Lstat(abs)
+        switch {
+        case err != nil:
+        case fi.Mode()&os.ModeSymlink != 0:
+            target, _ := os.Readlink(abs)
+            ids[p] = "link:" + target
+        case fi.Mode().IsRegular():
+            present = append(present, p)
+        }
+    }
+    if len(present) == 0 { return ids }
+    cmd := exec.Command("git", "hash-object", "--stdin-paths")
+    var out bytes.Buffer
+    cmd.Dir, cmd.Stdin, cmd.Stdout = repo, strings.NewReader(strings.Join(present, "\n")+"\n"), &out
+    if err := run(cmd); err != nil { return ids }
+    for i, id := range strings.Fields(out.String()) {
+        if i < len(present) { ids[present[i]] = id }
+    }
+    return ids
+}
+
 func CurrentBranch(repo string) string {
     out, _ := runOut(repo, "git", "rev-parse", "--abbrev-ref", "HEAD")
     return strings.TrimSpace(out)
 }
 
-func RenderMessage(tpl string, files []string, rc config.RepoConfig) string {
+// RenderMessage expands the commit message template. Besides {iso}, {unix},
+// {branch}, {file} and {count} it knows {files} (the changed paths, at most
+// five listed, moves as "old → new"), {renames} (only the moves), {summary}
+// (e.g. "2 created, 1 modified") and {reason}.
+func RenderMessage(tpl string, files []string, rc config.RepoConfig, note Note) string {
     now := time.Now()
     msg := strings.ReplaceAll(tpl, "{iso}", now.UTC().Format(time.RFC3339))
     msg = strings.ReplaceAll(msg, "{unix}", fmt.Sprintf("%d", now.Unix()))
     msg = strings.ReplaceAll(msg, "{branch}", firstNonEmpty(rc.Branch, CurrentBranch(rc.Path)))
     if len(files) > 0 { msg = strings.ReplaceAll(msg, "{file}", filepath.Base(files[0])) } else { msg = strings.ReplaceAll(msg, "{file}", "") }
     msg = strings.ReplaceAll(msg, "{count}", fmt.Sprintf("%d", len(files)))
+    msg = strings.ReplaceAll(msg, "{files}", listFiles(withRenames(files, note.Renames), 5))
+    msg = strings.ReplaceAll(msg, "{renames}", listRenames(note.Renames, 5))
+    msg = strings.ReplaceAll(msg, "{summary}", summarize(files, note.Ops, note.Renames))
+    msg = strings.ReplaceAll(msg, "{reason}", note.Reason)
     if strings.TrimSpace(msg) == "" { msg = "autosave" }
     return msg
 }
 
-func CommitAndMaybePush(rc config.RepoConfig, files []string) (string, error) {
+// CommitAndMaybePush stages everything, commits, records note under NotesRef
+// and pushes when configured. A clean tree yields an empty message. A note
+// that can't be written doesn't stop the push; it is reported as *NoteError
+// along with the message.
+func CommitAndMaybePush(rc config.RepoConfig, files []string, note Note) (string, error) {
     if !HasChanges(rc.Path) { return "", nil }
+    if t := TargetFor(rc, ReadHead(rc.Path)); t.Skip || t.Ref != "" {
+        return "", fmt.Errorf("refusing to commit on HEAD: %s", t.Why)
+    }
+
+    if err := stage(rc, nil, "", note.held()); err != nil { return "", err }
+    note.Renames = confirmRenames(note.Renames, rc.Path, nil, "diff", "--cached", "HEAD")
+
+    var (
+        msg     string
+        split   bool
+        err     error
+        noteErr error
+    )
+    if head, _ := runEnv(rc.Path, nil, "rev-parse", "-q", "--verify", "HEAD^{commit}"); splitting(rc) && head != "" {
+        msg, split, err = commitSeries(rc, nil, "HEAD", head, firstNonEmpty(rc.Branch, CurrentBranch(rc.Path)), []string{head}, note)
+        if _, ok := err.(*NoteError); ok { noteErr, err = err, nil }
+        if err != nil { return msg, err }
+    }
+    if !split {
+        msg = buildMessage(rc, files, note)
+
+        args := []string{"commit", "-m", msg}
+        if rc.Sign { args = append(args, "-S") }
+        if len(rc.SignArgs) > 0 { args = append(args, rc.SignArgs...) }
+
+        if err := mustRun(rc.Path, "git", args...); err != nil {
+            // if nothing to commit, surface no error
+            if strings.Contains(err.Error(), "nothing to commit") || strings.Contains(err.Error(), "exit status 1") {
+                return "", nil
+            }
+            return "", err
+        }
+
+        if err := WriteNote(rc.Path, "HEAD", note); err != nil { noteErr = &NoteError{Rev: "HEAD", Err: err} }
+    }
+
+    if rc.Push {
+        pushArgs := []string{"push", firstNonEmpty(rc.Remote, "origin")}
+        if rc.Branch != "" { pushArgs = append(pushArgs, fmt.Sprintf("HEAD:%s", rc.Branch)) }
+        if err := mustRun(rc.Path, "git", pushArgs...); err != nil { return msg, err }
+        if rc.PushNotes {
+            if err := PushNotes(rc.Path, rc.Remote); err != nil { return msg, err }
+        }
+    }
+
+    return msg, noteErr
+}
+
+// CommitToRef commits a snapshot onto ref without touching HEAD, the index
+// or the working tree. The snapshot starts from ref's tree (base's while ref
+// doesn't exist; with includes, base's outside them) and takes the working
+// tree state of only (everything when nil). Earlier history of ref is
+// kept as first parent; base is added as a parent when ref doesn't contain it.
+// Like CommitAndMaybePush it reports a failed note as *NoteError.
+func CommitToRef(rc config.RepoConfig, ref, base string, only, files []string, note Note) (string, error) {
+    idx, err := os.CreateTemp("", "autogit-index-*")
+    if err != nil { return "", err }
+    idx.Close()
+    os.Remove(idx.Name()) // git creates it on read-tree
+    defer os.Remove(idx.Name())
+    env := []string{"GIT_INDEX_FILE=" + idx.Name()}
+
+    tip, _ := runEnv(rc.Path, nil, "rev-parse", "-q", "--verify", ref+"^{commit}")
+    start := firstNonEmpty(tip, base)
+    if start == "" { return "", fmt.Errorf("commit to %s: no base commit", ref) }
+
+    // With includes the earlier autosave only speaks for the paths in scope:
+    // build the index from base, the current branch commit, and take just
+    // those from tip, so commits made on the branch meanwhile outside the
+    // scope aren't reverted by the merge.
+    if specs := includeSpecs(rc); tip != "" && base != "" && len(specs) > 0 {
+        if _, err := runEnv(rc.Path, env, "read-tree", base); err != nil { return "", err }
+        if _, err := runEnv(rc.Path, env, append([]string{"reset", "-q", tip, "--"}, specs...)...); err != nil { return "", err }
+    } else if _, err := runEnv(rc.Path, env, "read-tree", start); err != nil {
+        return "", err
+    }
+    if only != nil {
+        tracked, _ := runEnv(rc.Path, env, "ls-files", "--full-name", "--")
+        known := map[string]bool{}
+        for _, l := range strings.Split(tracked, "\n") { known[l] = true }
+        top, _ := runEnv(rc.Path, nil, "rev-parse", "--show-toplevel")
+        var specs []string
+        held := map[string]bool{}
+        for _, p := range note.held() { held[p] = true }
+        for _, p := range only {
+            if held[p] { continue }
+            abs := p
+            if !filepath.IsAbs(abs) { abs = filepath.Join(rc.Path, p) }
+            rel, _ := filepath.Rel(top, absPath(abs))
+            if _, err := os.Lstat(filepath.Join(abs, ".git")); err == nil && !known[filepath.ToSlash(rel)] { continue } // embedded repo
+            if _, err := os.Lstat(abs); err == nil || known[filepath.ToSlash(rel)] { specs = append(specs, abs) }
+        }
+        if len(specs) == 0 { return "", nil }
+        addArgs := append(append([]string{"add", "-A", "--"}, specs...), noiseSpecs(rc, "exclude,glob")...)
+        if _, err := runEnv(rc.Path, env, addArgs...); err != nil { return "", err }
+    } else if err := stage(rc, env, start, note.held()); err != nil {
+        return "", err
+    }
+    tree, err := runEnv(rc.Path, env, "write-tree")
+    if err != nil { return "", err }
+    if cur, _ := runEnv(rc.Path, nil, "rev-parse", start+"^{tree}"); cur == tree { return "", nil }
+    note.Renames = confirmRenames(note.Renames, rc.Path, nil, "diff-tree", "-r", start, tree)
+
+    parents := []string{start}
+    if tip != "" && base != "" && !IsAncestor(rc.Path, base, tip) { parents = append(parents, base) }
+
+    rrc := rc
+    rrc.Branch = strings.TrimPrefix(ref, "refs/heads/")
+    var (
+        msg     string
+        split   bool
+        noteErr error
+    )
+    if splitting(rc) {
+        var branch string
+        if strings.HasPrefix(ref, "refs/heads/") { branch = rrc.Branch }
+        msg, split, err = commitSeries(rrc, env, ref, tip, branch, parents, note)
+        if _, ok := err.(*NoteError); ok { noteErr, err = err, nil }
+        if err != nil { return msg, err }
+    }
+    if !split {
+        msg = buildMessage(rrc, files, note)
+        args := []string{"commit-tree", tree, "-m", msg}
+        for _, p := range parents { args = append(args, "-p", p) }
+        if rc.Sign { args = append(args, "-S") }
+        if len(rc.SignArgs) > 0 { args = append(args, rc.SignArgs...) }
+        sha, err := runEnv(rc.Path, nil, args...)
+        if err != nil { return "", err }
+        if _, err := runEnv(rc.Path, nil, "update-ref", "-m", "autoGit: "+note.Reason, ref, sha, tip); err != nil { return "", err }
+
+        note.Target = ref
+        if err := WriteNote(rc.Path, sha, note); err != nil { noteErr = &NoteError{Rev: sha, Err: err} }
+    }
+
+    if rc.Push && strings.HasPrefix(ref, "refs/heads/") {
+        if err := mustRun(rc.Path, "git", "push", firstNonEmpty(rc.Remote, "origin"), ref+":"+ref); err != nil { return msg, err }
+        if rc.PushNotes {
+            if err := PushNotes(rc.Path, rc.Remote); err != nil { return msg, err }
+        }
+    }
+    return msg, noteErr
+}
+
+// noiseSpecs turns rc's noise patterns into pathspecs with magic, e.g.
+// "exclude,glob" so staging skips the same files the watcher ignores.
+func noiseSpecs(rc config.RepoConfig, magic string) []string {
+    noise, _ := rc.NoisePatterns()
+    var specs []string
+    for _, p := range noise { specs = append(specs, globSpecs(magic, p)...) }
+    return specs
+}
 
-    if err := mustRun(rc.Path, "git", "add", "-A"); err != nil { return "", err }
+// ruleSpecs turns the globs of rc's path rules into pathspecs with magic;
+// those paths are committed by their own rule, not with the rest.
+func ruleSpecs(rc config.RepoConfig, magic string) []string {
+    var specs []string
+    for _, r := range rc.PathRules {
+        for _, p := range r.Match {
+            if p = strings.TrimSpace(p); strings.Trim(p, "/") != "" { specs = append(specs, globSpecs(magic, p)...) }
+        }
+    }
+    return specs
+}
+
+// literalSpecs prefixes each path with magic.
+func literalSpecs(magic string, paths []string) []string {
+    specs := make([]string, 0, len(paths))
+    for _, p := range paths { specs = append(specs, ":("+magic+")"+p) }
+    return specs
+}
+
+// globSpecs converts a gitignore-style pattern to pathspecs with magic: a
+// pattern without a slash matches at any depth, one with a leading or inner
+// slash from the top. The second spec covers everything below a matching
+// directory, which glob pathspecs don't do by themselves.
+func globSpecs(magic, p string) []string {
+    p = strings.TrimSuffix(p, "/")
+    if !strings.Contains(p, "/") { p = "**/" + p }
+    p = ":(" + magic + ")" + strings.TrimPrefix(p, "/")
+    return []string{p, p + "/**"}
+}
+
+// includeSpecs turns rc.Includes into glob pathspecs; nil means the whole
+// repo.
+func includeSpecs(rc config.RepoConfig) []string {
+    var specs []string
+    for _, p := range rc.Includes {
+        if p = strings.TrimSpace(p); strings.Trim(p, "/") != "" { specs = append(specs, globSpecs("glob", p)...) }
+    }
+    return specs
+}
+
+// stage runs git add -A over rc's scope: rc.Path, or each of rc.Includes on
+// its own since git rejects a pathspec that matches nothing. Glob includes
+// can't be combined with exclude pathspecs (git then skips untracked
+// directories), so there noise is unstaged again after adding instead;
+// paths the user had staged by hand get their entries back. Paths claimed
+// by rc.PathRules are left to their rule's commits. Untracked embedded
+// repositories are always left out; with includes that means adding their
+// siblings file by file. Paths in hold stay as they are in base. A path
+// rule's share (rc.RuleMatch) is staged by stageRule.
+func stage(rc config.RepoConfig, env []string, base string, hold []string) error {
+    specs := includeSpecs(rc)
+    if len(rc.RuleMatch) > 0 { return stageRule(rc, env, specs, hold) }
+    embedded := embeddedSpecs(rc.Path, "exclude,literal")
+    if len(specs) == 0 {
+        args := append(append([]string{"add", "-A", "--", "."}, noiseSpecs(rc, "exclude,glob")...), ruleSpecs(rc, "exclude,glob")...)
+        _, err := runEnv(rc.Path, env, append(append(args, embedded...), literalSpecs("exclude,literal", hold)...)...)
+        return err
+    }
+    drop := append(append(noiseSpecs(rc, "glob"), ruleSpecs(rc, "glob")...), literalSpecs("literal", hold)...)
+    byHand, err := stagedIn(rc.Path, env, base, drop)
+    if err != nil { return err }
+    var entries string
+    if len(byHand) > 0 {
+        if entries, err = runEnv(rc.Path, env, append([]string{"ls-files", "-s", "-z", "--full-name", "--"}, drop...)...); err != nil { return err }
+    }
+    for _, spec := range specs {
+        var err error
+        if len(embedded) > 0 {
+            err = addFiles(rc.Path, env, spec)
+        } else {
+            _, err = runEnv(rc.Path, env, "add", "-A", "--", spec)
+        }
+        if err != nil && !strings.Contains(err.Error(), "did not match any files") { return err }
+    }
+    return unstage(rc.Path, env, base, drop, byHand, entries)
+}
+
+// stageRule stages a path rule's share: the changed files matching both the
+// rule's globs and the includes, minus noise, earlier rules and hold. They
+// are added by name, so nothing else in the index is touched.
+func stageRule(rc config.RepoConfig, env []string, includes, hold []string) error {
+    var match []string
+    for _, p := range rc.RuleMatch {
+        if p = strings.TrimSpace(p); strings.Trim(p, "/") != "" { match = append(match, globSpecs("glob", p)...) }
+    }
+    files, err := changedFiles(rc.Path, env, match)
+    if err != nil || len(files) == 0 { return err }
+    keep := func(specs []string, want bool) error {
+        if len(specs) == 0 { return nil }
+        in, err := changedFiles(rc.Path, env, specs)
+        if err != nil { return err }
+        set := make(map[string]bool, len(in))
+        for _, f := range in { set[f] = true }
+        files = slices.DeleteFunc(files, func(f string) bool { return set[f] != want })
+        return nil
+    }
+    if err := keep(includes, true); err != nil { return err }
+    if err := keep(append(append(noiseSpecs(rc, "glob"), ruleSpecs(rc, "glob")...), literalSpecs("literal", hold)...), false); err != nil { return err }
+    return addPaths(rc.Path, env, files)
+}
+
+// stagedIn returns the paths (relative to the top) matching specs whose
+// index entry differs from base, HEAD when empty.
+func stagedIn(dir string, env []string, base string, specs []string) (map[string]bool, error) {
+    paths := map[string]bool{}
+    if len(specs) == 0 { return paths, nil }
+    args := []string{"diff", "--cached", "--name-only", "-z", "--no-renames"}
+    if base != "" { args = append(args, base) }
+    out, err := runEnv(dir, env, append(append(args, "--"), specs...)...)
+    if err != nil { return nil, err }
+    for _, p := range splitNul(out) { paths[p] = true }
+    return paths, nil
+}
+
+// unstage resets the paths matching specs that stage added back to base.
+// Those in byHand were staged before stage ran; they get their entries
+// from entries (ls-files -s -z --full-name output) back instead.
+func unstage(dir string, env []string, base string, specs []string, byHand map[string]bool, entries string) error {
+    now, err := stagedIn(dir, env, base, specs)
+    if err != nil { return err }
+    var added []string
+    for p := range now {
+        if !byHand[p] { added = append(added, p) }
+    }
+    sort.Strings(added)
+    for len(added) > 0 {
+        n := min(len(added), 500)
+        args := []string{"reset", "-q"}
+        if base != "" { args = append(args, base) }
+        if _, err := runEnv(dir, env, append(append(args, "--"), literalSpecs("top,literal", added[:n])...)...); err != nil { return err }
+        added = added[n:]
+    }
+    if len(byHand) == 0 { return nil }
 
-    // trailers
+    var info bytes.Buffer
+    kept := map[string]bool{}
+    for _, l := range splitNul(entries) {
+        if meta, p, ok := strings.Cut(l, "\t"); ok && byHand[p] {
+            fmt.Fprintf(&info, "%s\t%s\x00", meta, p)
+            kept[p] = true
+        }
+    }
+    for p := range byHand {
+        if !kept[p] { fmt.Fprintf(&info, "0 0000000000000000000000000000000000000000\t%s\x00", p) } // staged removal
+    }
+    top, err := runEnv(dir, nil, "rev-parse", "--show-toplevel")
+    if err != nil { return err }
+    cmd := exec.Command("git", "update-index", "-z", "--index-info")
+    var out bytes.Buffer
+    cmd.Dir, cmd.Env, cmd.Stdin, cmd.Stdout, cmd.Stderr = top, append(os.Environ(), env...), &info, &out, &out
+    if err := run(cmd); err != nil {
+        return fmt.Errorf("git update-index: %w (%s)", err, strings.TrimSpace(out.String()))
+    }
+    return nil
+}
+
+// buildMessage renders rc.Msg and appends the configured trailers and an
+// Autosave-Reason trailer, plus an Autosave-Trigger trailer when a limit cut
+// the batch short and an Autosave-Session trailer on each part of a split
+// autosave. The Autosave-* trailers let reports find autosaves whose notes
+// weren't fetched.
+func buildMessage(rc config.RepoConfig, files []string, note Note) string {
     trailerLines := make([]string, 0, len(rc.Trailers))
     keys := make([]string, 0, len(rc.Trailers))
     for k := range rc.Trailers { keys = append(keys, k) }
     sort.Strings(keys)
     for _, k := range keys { trailerLines = append(trailerLines, fmt.Sprintf("%s: %s", k, rc.Trailers[k])) }
+    if note.Reason != "" { trailerLines = append(trailerLines, "Autosave-Reason: "+note.Reason) }
+    if note.Session != "" { trailerLines = append(trailerLines, fmt.Sprintf("Autosave-Session: %s %s", note.Session, note.Part)) }
+    if note.Trigger != "" { trailerLines = append(trailerLines, fmt.Sprintf("Autosave-Trigger: %s (%s)", note.Reason, note.Trigger)) }
 
-    msg := RenderMessage(rc.Msg, files, rc)
-    if len(trailerLines) > 0 { msg = msg + "
-
-" + strings.Join(trailerLines, "
-") }
+    msg := RenderMessage(rc.Msg, files, rc, note)
+    if len(trailerLines) > 0 { msg = msg + "\n\n" + strings.Join(trailerLines, "\n") }
+    return msg
+}
 
-    args := []string{"commit", "-m", msg}
-    if rc.Sign { args = append(args, "-S") }
-    if len(rc.SignArgs) > 0 { args = append(args, rc.SignArgs...) }
+func listFiles(files []string, max int) string {
+    if len(files) <= max { return strings.Join(files, ", ") }
+    return fmt.Sprintf("%s and %d more", strings.Join(files[:max], ", "), len(files)-max)
+}
 
-    if err := mustRun(rc.Path, "git", args...); err != nil {
-        // if nothing to commit, surface no error
-        if strings.Contains(err.Error(), "nothing to commit") || strings.Contains(err.Error(), "exit status 1") {
-            return "", nil
+// summarize counts paths by what happened to them, e.g. "2 created, 1 modified".
+func summarize(files []string, ops map[string]string, renames map[string]string) string {
+    var created, modified, removed, renamed int
+    in := make(map[string]bool, len(files))
+    for _, f := range files { in[f] = true }
+    sources := make(map[string]string, len(renames))
+    for o, n := range renames { sources[n] = o }
+    for _, f := range files {
+        op := ops[f]
+        src, target := sources[f]
+        switch _, moved := renames[f]; {
+        case moved: renamed++
+        case target && in[src]: // counted with its source
+        case target: renamed++
+        case strings.Contains(op, "rename"): renamed++
+        case strings.Contains(op, "remove"): removed++
+        case strings.Contains(op, "create"): created++
+        default: modified++
         }
-        return "", err
     }
-
-    if rc.Push {
-        pushArgs := []string{"push", firstNonEmpty(rc.Remote, "origin")}
-        if rc.Branch != "" { pushArgs = append(pushArgs, fmt.Sprintf("HEAD:%s", rc.Branch)) }
-        if err := mustRun(rc.Path, "git", pushArgs...); err != nil { return msg, err }
+    var parts []string
+    for _, c := range []struct { n int; what string }{{created, "created"}, {modified, "modified"}, {removed, "removed"}, {renamed, "renamed"}} {
+        if c.n > 0 { parts = append(parts, fmt.Sprintf("%d %s", c.n, c.what)) }
     }
+    if len(parts) == 0 { return "no file changes" }
+    return strings.Join(parts, ", ")
+}
 
-    return msg, nil
+// runEnv runs git with extra environment and returns trimmed stdout.
+func runEnv(dir string, env []string, args ...string) (string, error) {
+    cmd := exec.Command("git", args...)
+    cmd.Dir = dir
+    if len(env) > 0 { cmd.Env = append(os.Environ(), env...) }
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+    if err := run(cmd); err != nil {
+        return "", fmt.Errorf("git %s: %w (%s)", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+    }
+    return strings.TrimSpace(stdout.String()), nil
 }
 
+func absPath(p string) string { if a, err := filepath.Abs(p); err == nil { return a } ; return p }
+
 func firstNonEmpty(a ...string) string { for _, s := range a { if strings.TrimSpace(s) != "" { return s } } ; return "" }
\ No newline at end of file
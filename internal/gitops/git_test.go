@@ -0,0 +1,165 @@
+package gitops
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestCommitToRefLeavesHeadAlone(t *testing.T) {
+    root := testutil.NewRepo(t)
+    base := testutil.Commit(t, root, "README", "hi\n", "init")
+    testutil.Write(t, root, "a.txt", "a\n")
+    testutil.Write(t, root, "b.txt", "b\n")
+    testutil.Git(t, root, "add", "b.txt")
+    rc := config.DefaultRepo(root)
+    ref := AutosaveRef("work")
+
+    // everything dirty, from base
+    if _, err := CommitToRef(rc, ref, base, nil, nil, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "rev-parse", "HEAD"); got != base { t.Errorf("HEAD moved to %s", got) }
+    if got := testutil.Git(t, root, "diff", "--cached", "--name-only"); got != "b.txt" { t.Errorf("index has %q staged, want b.txt", got) }
+    if got := testutil.Git(t, root, "show", "--format=", "--name-only", ref); got != "a.txt\nb.txt" { t.Errorf("%s got %q", ref, got) }
+    if got := testutil.Git(t, root, "rev-parse", ref+"^"); got != base { t.Errorf("%s parent = %s, want base", ref, got) }
+    if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", ref); !strings.Contains(out, `"target":"`+ref+`"`) {
+        t.Errorf("note = %s", out)
+    }
+
+    // only the named paths, on top of the earlier autosave
+    first := testutil.Git(t, root, "rev-parse", ref)
+    testutil.Write(t, root, "a.txt", "a2\n")
+    testutil.Write(t, root, "c.txt", "c\n")
+    if _, err := CommitToRef(rc, ref, base, []string{"c.txt"}, []string{"c.txt"}, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "show", "--format=", "--name-only", ref); got != "c.txt" { t.Errorf("%s got %q, want c.txt", ref, got) }
+    if got := testutil.Git(t, root, "rev-parse", ref+"^"); got != first { t.Errorf("%s parent = %s, want the earlier autosave", ref, got) }
+
+    // nothing new: no commit
+    second := testutil.Git(t, root, "rev-parse", ref)
+    if msg, err := CommitToRef(rc, ref, base, []string{"c.txt"}, []string{"c.txt"}, Note{Reason: "batch"}); err != nil || msg != "" {
+        t.Errorf("unchanged commit = %q, %v", msg, err)
+    }
+    if got := testutil.Git(t, root, "rev-parse", ref); got != second { t.Error("ref moved without changes") }
+}
+
+func TestCommitRefusesProtectedHead(t *testing.T) {
+    root := testutil.NewRepo(t)
+    base := testutil.Commit(t, root, "README", "hi\n", "init")
+    testutil.Git(t, root, "checkout", "-q", "-b", "main")
+    testutil.Write(t, root, "a.txt", "a\n")
+
+    msg, err := CommitAndMaybePush(config.DefaultRepo(root), nil, Note{Reason: "batch"})
+    if err == nil || msg != "" { t.Fatalf("commit on main = %q, %v; want a refusal", msg, err) }
+    if got := testutil.Git(t, root, "rev-parse", "HEAD"); got != base { t.Errorf("HEAD moved to %s", got) }
+}
+
+func TestCommitSkipsNoise(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    testutil.Write(t, root, "a.go", "package a\n")
+    testutil.Write(t, root, "a.go.swp", "swap\n")
+    testutil.Write(t, root, ".DS_Store", "mac\n")
+
+    if _, err := CommitAndMaybePush(config.DefaultRepo(root), nil, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "show", "--format=", "--name-only", "HEAD"); got != "a.go" { t.Errorf("committed %q, want a.go", got) }
+}
+
+func TestSizeFlushTrailer(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    testutil.Write(t, root, "big.bin", "0123456789")
+
+    rc := config.DefaultRepo(root)
+    note := Note{Reason: "size", Trigger: "10 bytes, max_batch_bytes 8"}
+    if _, err := CommitAndMaybePush(rc, []string{"big.bin"}, note); err != nil { t.Fatal(err) }
+    got := testutil.Git(t, root, "log", "-1", "--format=%(trailers:key=Autosave-Trigger,valueonly)")
+    if got != "size (10 bytes, max_batch_bytes 8)" { t.Errorf("Autosave-Trigger = %q", got) }
+
+    testutil.Write(t, root, "big.bin", "changed")
+    if _, err := CommitAndMaybePush(rc, []string{"big.bin"}, Note{Reason: "idle"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "log", "-1", "--format=%B"); strings.Contains(got, "Autosave-Trigger") { t.Errorf("idle autosave carries a trigger: %q", got) }
+}
+
+func TestStageKeepsWhatWasStagedByHand(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    testutil.Write(t, root, "src/a.go", "package a\n")
+    testutil.Write(t, root, "src/b.tmp", "staged\n")
+    testutil.Git(t, root, "add", "src/b.tmp")
+    testutil.Write(t, root, "src/b.tmp", "worktree\n")
+    testutil.Write(t, root, "src/c.tmp", "noise\n")
+
+    rc := config.DefaultRepo(root)
+    rc.Includes = []string{"src"}
+    if err := stage(rc, nil, "", nil); err != nil { t.Fatal(err) }
+
+    if got := testutil.Git(t, root, "diff", "--cached", "--name-only"); got != "src/a.go\nsrc/b.tmp" {
+        t.Errorf("staged %q, want src/a.go and src/b.tmp", got)
+    }
+    if got := testutil.Git(t, root, "show", ":src/b.tmp"); got != "staged" {
+        t.Errorf("src/b.tmp staged as %q, want the hand-staged content", got)
+    }
+}
+
+func TestStageRuleStaysWithinIncludes(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    for _, f := range []string{"src/a.go", "src/a.txt", "src/x.md", "src/sub/y.md", "docs/z.md"} { testutil.Write(t, root, f, f+"\n") }
+
+    rc := config.DefaultRepo(root)
+    rc.Includes = []string{"src"}
+    rc.PathRules = []config.PathRule{{Match: []string{"*.txt"}}, {Match: []string{"*.md"}}}
+    if err := stage(rc.Rule(1), nil, "", []string{"src/sub/y.md"}); err != nil { t.Fatal(err) }
+
+    if got := testutil.Git(t, root, "diff", "--cached", "--name-only"); got != "src/x.md" {
+        t.Errorf("staged %q, want only src/x.md", got)
+    }
+}
+
+func TestStageSkipsNoise(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    testutil.Write(t, root, "a.go", "package a\n")
+    testutil.Write(t, root, "a.go.swp", "swap\n")
+    testutil.Write(t, root, ".DS_Store", "mac\n")
+    testutil.Write(t, root, "#a.go#", "emacs\n")
+    testutil.Write(t, root, "docs/#b.md#", "emacs\n")
+    testutil.Write(t, root, "held.txt", "held\n")
+
+    rc := config.DefaultRepo(root)
+    if err := stage(rc, nil, "", []string{"held.txt"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "diff", "--cached", "--name-only"); got != "a.go" { t.Errorf("staged %q, want a.go", got) }
+
+    // with includes noise is unstaged again after adding
+    testutil.Git(t, root, "reset", "-q")
+    rc.Includes = []string{"*"}
+    if err := stage(rc, nil, "", []string{"held.txt"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "diff", "--cached", "--name-only"); got != "a.go" { t.Errorf("staged %q with includes, want a.go", got) }
+}
+
+func TestCommitToRefKeepsBranchOutsideIncludes(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Write(t, root, "src/a.go", "package a\n")
+    base := testutil.Commit(t, root, "other.txt", "v1\n", "init")
+    rc := config.DefaultRepo(root)
+    rc.Includes = []string{"src"}
+    ref := AutosaveRef("work")
+
+    testutil.Write(t, root, "src/a.go", "package a // 1\n")
+    if _, err := CommitToRef(rc, ref, base, nil, nil, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+
+    // other.txt moves on on the branch, outside the includes
+    base = testutil.Commit(t, root, "other.txt", "v2\n", "by hand")
+    testutil.Write(t, root, "src/a.go", "package a // 2\n")
+    if _, err := CommitToRef(rc, ref, base, nil, nil, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+
+    if got := testutil.Git(t, root, "show", ref+":other.txt"); got != "v2" { t.Errorf("other.txt on %s = %q, want v2", ref, got) }
+    if got := testutil.Git(t, root, "show", ref+":src/a.go"); got != "package a // 2" { t.Errorf("src/a.go on %s = %q", ref, got) }
+    if got := testutil.Git(t, root, "rev-parse", ref+"^2"); got != base { t.Errorf("%s second parent = %s, want the branch", ref, got) }
+
+    // an earlier autosave's paths in scope are carried over
+    testutil.Write(t, root, "src/b.go", "package a\n")
+    if _, err := CommitToRef(rc, ref, base, []string{"src/b.go"}, []string{"src/b.go"}, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+    if got := testutil.Git(t, root, "show", ref+":src/a.go"); got != "package a // 2" { t.Errorf("src/a.go on %s = %q after a named commit", ref, got) }
+}
@@ -0,0 +1,119 @@
+package gitops
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// The git processes running for autoGit, so a forced exit can stop them
+// rather than leave one holding index.lock behind.
+var (
+    inflightMu sync.Mutex
+    inflight   = map[*exec.Cmd]running{}
+    aborted    bool
+)
+
+// running is an in-flight git process.
+type running struct {
+    what  string // what it is doing, for the log
+    start time.Time
+}
+
+// errAborted is returned for git commands started after Abort.
+var errAborted = errors.New("autoGit is exiting")
+
+// run runs cmd like cmd.Run, tracked as in flight until it exits.
+func run(cmd *exec.Cmd) error {
+    inflightMu.Lock()
+    if aborted { inflightMu.Unlock(); return errAborted }
+    start := time.Now()
+    if err := cmd.Start(); err != nil { inflightMu.Unlock(); return err }
+    inflight[cmd] = running{what: describe(cmd), start: start}
+    inflightMu.Unlock()
+    defer func() {
+        inflightMu.Lock()
+        delete(inflight, cmd)
+        inflightMu.Unlock()
+    }()
+    return cmd.Wait()
+}
+
+// describe names cmd's subcommand and directory, leaving out arguments such
+// as commit messages.
+func describe(cmd *exec.Cmd) string {
+    sub := ""
+    for _, a := range cmd.Args[1:] {
+        if !strings.HasPrefix(a, "-") { sub = a; break }
+    }
+    return fmt.Sprintf("%s %s (%s)", filepath.Base(cmd.Path), sub, cmd.Dir)
+}
+
+// Abort stops every git process autoGit has running and refuses to start
+// more. Each is interrupted, which lets git remove its lock files, and
+// killed if it hasn't exited after wait. A killed git can't clean up, so an
+// index.lock it leaves behind is removed. It returns what was cut off.
+func Abort(wait time.Duration) []string {
+    inflightMu.Lock()
+    aborted = true
+    var ops []string
+    for cmd, r := range inflight {
+        ops = append(ops, r.what)
+        if err := cmd.Process.Signal(os.Interrupt); err != nil { _ = cmd.Process.Kill() } // no SIGINT on Windows
+    }
+    inflightMu.Unlock()
+    sort.Strings(ops)
+
+    if waitInflight(wait) { return ops }
+    inflightMu.Lock()
+    killed := make(map[*exec.Cmd]running, len(inflight))
+    for cmd, r := range inflight {
+        killed[cmd] = r
+        _ = cmd.Process.Kill()
+    }
+    inflightMu.Unlock()
+    waitInflight(time.Second)
+
+    var cut []string
+    for cmd, r := range killed { cut = append(cut, r.what+" (killed"+staleLock(cmd, r.start)+")") }
+    sort.Strings(cut)
+    return append(ops, cut...)
+}
+
+// waitInflight waits up to d for every tracked git process to exit and
+// reports whether they did.
+func waitInflight(d time.Duration) bool {
+    for end := time.Now().Add(d); ; time.Sleep(20 * time.Millisecond) {
+        inflightMu.Lock()
+        n := len(inflight)
+        inflightMu.Unlock()
+        if n == 0 { return true }
+        if !time.Now().Before(end) { return false }
+    }
+}
+
+// lockSlack allows for file timestamps coarser than the clock.
+const lockSlack = time.Second
+
+// staleLock removes the index.lock of cmd's repository when it was created
+// after cmd started, so by cmd, and describes what it found for the log.
+// An older lock belongs to someone else and is left alone.
+func staleLock(cmd *exec.Cmd, start time.Time) string {
+    q := exec.Command("git", "rev-parse", "--git-path", "index")
+    q.Dir, q.Env = cmd.Dir, cmd.Env
+    out, err := q.Output()
+    if err != nil { return "" }
+    lock := strings.TrimSpace(string(out)) + ".lock"
+    if !filepath.IsAbs(lock) { lock = filepath.Join(cmd.Dir, lock) }
+    fi, err := os.Stat(lock)
+    if err != nil { return "" }
+    if fi.ModTime().Add(lockSlack).Before(start) { return "; " + lock + " predates it, left in place" }
+    if err := os.Remove(lock); err != nil { return fmt.Sprintf("; couldn't remove stale %s: %v", lock, err) }
+    return "; removed stale " + lock
+}
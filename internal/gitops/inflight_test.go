@@ -0,0 +1,89 @@
+package gitops
+
+import (
+    "errors"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+
+    "github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestAbortStopsRunningGit(t *testing.T) {
+    root := testutil.NewRepo(t)
+    t.Cleanup(func() { inflightMu.Lock(); aborted = false; inflightMu.Unlock() })
+
+    // hash-object waits for stdin that never comes
+    r, w, err := os.Pipe()
+    if err != nil { t.Fatal(err) }
+    defer w.Close()
+    defer r.Close()
+    cmd := exec.Command("git", "hash-object", "--stdin")
+    cmd.Dir, cmd.Stdin = root, r
+    done := make(chan error, 1)
+    go func() { done <- run(cmd) }()
+    for end := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+        inflightMu.Lock()
+        n := len(inflight)
+        inflightMu.Unlock()
+        if n == 1 { break }
+        if time.Now().After(end) { t.Fatal("git never started") }
+    }
+
+    if got, want := Abort(time.Second), []string{"git hash-object (" + root + ")"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Abort = %q, want %q", got, want)
+    }
+    select {
+    case err := <-done:
+        if err == nil { t.Error("interrupted git reported success") }
+    case <-time.After(5 * time.Second):
+        t.Fatal("git still running after Abort")
+    }
+    if _, err := runEnv(root, nil, "status"); !errors.Is(err, errAborted) {
+        t.Errorf("git after Abort: %v, want errAborted", err)
+    }
+}
+
+func TestAbortRemovesTheLockOfAKilledGit(t *testing.T) {
+    if _, err := exec.LookPath("sh"); err != nil { t.Skip("no sh") }
+    t.Cleanup(func() { inflightMu.Lock(); aborted = false; inflightMu.Unlock() })
+    ours, theirs := testutil.NewRepo(t), testutil.NewRepo(t)
+    // theirs was locked by someone else before anything of ours ran
+    old := filepath.Join(theirs, ".git", "index.lock")
+    if err := os.WriteFile(old, nil, 0o644); err != nil { t.Fatal(err) }
+    hour := time.Now().Add(-time.Hour)
+    os.Chtimes(old, hour, hour)
+
+    // stand-ins for a git that takes index.lock and ignores the interrupt
+    const script = `trap "" INT; [ -e .git/index.lock ] || : > .git/index.lock; echo ready; sleep 10`
+    done := make(chan error, 2)
+    for _, root := range []string{ours, theirs} {
+        cmd := exec.Command("sh", "-c", script)
+        cmd.Dir = root
+        out, err := cmd.StdoutPipe()
+        if err != nil { t.Fatal(err) }
+        go func() { done <- run(cmd) }()
+        buf := make([]byte, 6)
+        if _, err := io.ReadFull(out, buf); err != nil { t.Fatal(err) }
+    }
+
+    got := Abort(100 * time.Millisecond)
+    for i := 0; i < 2; i++ { <-done }
+    oursLock := filepath.Join(ours, ".git", "index.lock")
+    want := []string{
+        "sh " + script + " (" + ours + ")",
+        "sh " + script + " (" + theirs + ")",
+        "sh " + script + " (" + ours + ") (killed; removed stale " + oursLock + ")",
+        "sh " + script + " (" + theirs + ") (killed; " + old + " predates it, left in place)",
+    }
+    sort.Strings(want[:2])
+    sort.Strings(want[2:])
+    if !reflect.DeepEqual(got, want) { t.Errorf("Abort =\n%q\nwant\n%q", got, want) }
+    if _, err := os.Stat(oursLock); !os.IsNotExist(err) { t.Errorf("%s still there: %v", oursLock, err) }
+    if _, err := os.Stat(old); err != nil { t.Errorf("someone else's lock removed: %v", err) }
+}
@@ -0,0 +1,177 @@
+package gitops
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "time"
+)
+
+// NotesRef holds one JSON note per autosave commit.
+const NotesRef = "refs/notes/autogit"
+
+// Version is stamped into every note; main overrides it at startup.
+var Version = "dev"
+
+// Note is the metadata recorded for an autosave commit.
+type Note struct {
+    Reason     string    `json:"reason"`
+    Paths      []string  `json:"paths"`
+    Ops        map[string]string `json:"ops,omitempty"` // path -> create|write|remove|rename|chmod
+    Renames    map[string]string `json:"renames,omitempty"` // old -> new, confirmed by git
+    BatchStart time.Time `json:"batch_start"`
+    BatchEnd   time.Time `json:"batch_end"`
+    Host       string    `json:"host"`
+    Events     int       `json:"events"`
+    Suppressed int       `json:"suppressed,omitempty"` // no-op events dropped during the batch
+    Deferred   []string  `json:"deferred,omitempty"`   // still being written; left for the next autosave
+    Carried    []string  `json:"carried,omitempty"`    // committed to the previous branch at a checkout; left out until edited again
+    Trigger    string    `json:"trigger,omitempty"`    // the limit that cut the batch short, e.g. "120 files, max_batch_files 100"
+    Session    string    `json:"session,omitempty"`    // shared by the parts of a split autosave
+    Part       string    `json:"part,omitempty"`       // e.g. "2/5"
+    Version    string    `json:"version"`
+    Target     string    `json:"target,omitempty"`   // ref committed to when not HEAD
+    Redirect   string    `json:"redirect,omitempty"` // why the autosave didn't go to HEAD
+}
+
+// held lists the paths an autosave leaves as they are.
+func (n Note) held() []string { return append(append([]string(nil), n.Deferred...), n.Carried...) }
+
+// NoteError reports that an autosave was committed but its note couldn't be
+// written; the commit itself stands.
+type NoteError struct {
+    Rev string
+    Err error
+}
+
+func (e *NoteError) Error() string { return fmt.Sprintf("note for %s: %v", e.Rev, e.Err) }
+func (e *NoteError) Unwrap() error { return e.Err }
+
+// Autosave is a commit that carries an autoGit note.
+type Autosave struct {
+    Hash    string
+    When    time.Time
+    Subject string
+    Note    Note
+}
+
+func runStdin(dir string, stdin []byte, name string, args ...string) error {
+    cmd := exec.Command(name, args...)
+    cmd.Dir = dir
+    cmd.Stdin = bytes.NewReader(stdin)
+    var stderr bytes.Buffer
+    cmd.Stderr = &stderr
+    if err := run(cmd); err != nil {
+        return fmt.Errorf("%s %s: %w (%s)", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+    }
+    return nil
+}
+
+// WriteNote attaches n to rev under NotesRef, replacing any existing note.
+func WriteNote(repo, rev string, n Note) error {
+    if n.Host == "" { n.Host, _ = os.Hostname() }
+    if n.Version == "" { n.Version = Version }
+    b, err := json.Marshal(n)
+    if err != nil { return err }
+    return runStdin(repo, b, "git", "notes", "--ref", NotesRef, "add", "-f", "-F", "-", rev)
+}
+
+// ReadNote returns the note attached to rev; found is false when there is none.
+func ReadNote(repo, rev string) (n Note, found bool, err error) {
+    out, err := runOut(repo, "git", "notes", "--ref", NotesRef, "show", rev)
+    if err != nil { return Note{}, false, nil }
+    if err := json.Unmarshal([]byte(out), &n); err != nil { return Note{}, false, fmt.Errorf("note %s: %w", rev, err) }
+    return n, true, nil
+}
+
+// PushNotes pushes NotesRef to remote.
+func PushNotes(repo, remote string) error {
+    return mustRun(repo, "git", "push", firstNonEmpty(remote, "origin"), NotesRef)
+}
+
+// Autosaves lists autosave commits reachable from HEAD, autosave/* branches
+// and shadow refs, newest first: those with a note, and those whose note is
+// missing (notes aren't fetched by default) but that carry Autosave-*
+// trailers, with what the trailers tell.
+// A zero since means no lower bound; limit <= 0 means no limit.
+func Autosaves(repo string, since time.Time, limit int) ([]Autosave, error) {
+    args := []string{"log", "HEAD", "--branches=autosave/*", "--glob=refs/autogit/*", "--no-notes", "--notes=" + NotesRef, "--format=%H%x1f%cI%x1f%s%x1f%(trailers:only,unfold,separator=%x1d)%x1f%N%x1e"}
+    if !since.IsZero() { args = append(args, "--since="+since.Format(time.RFC3339)) }
+    out, err := runOut(repo, "git", args...)
+    if err != nil { return nil, fmt.Errorf("git log (%s): %w", repo, err) }
+
+    var list []Autosave
+    for _, rec := range strings.Split(out, "\x1e") {
+        f := strings.SplitN(strings.TrimSpace(rec), "\x1f", 5)
+        if len(f) < 5 { continue }
+        var (
+            n  Note
+            ok bool
+        )
+        if note := strings.TrimSpace(f[4]); note != "" {
+            ok = json.Unmarshal([]byte(note), &n) == nil
+        } else {
+            n, ok = trailerNote(f[3])
+        }
+        if !ok { continue }
+        when, _ := time.Parse(time.RFC3339, f[1])
+        list = append(list, Autosave{Hash: f[0], When: when, Subject: f[2], Note: n})
+        if limit > 0 && len(list) >= limit { break }
+    }
+    return list, nil
+}
+
+// trailerNote rebuilds what it can of a note from a commit's trailers
+// (separated by \x1d); ok is false when none of them is an Autosave-* one.
+func trailerNote(trailers string) (n Note, ok bool) {
+    for _, l := range strings.Split(trailers, "\x1d") {
+        k, v, found := strings.Cut(l, ":")
+        if !found || !strings.HasPrefix(k, "Autosave-") { continue }
+        ok, v = true, strings.TrimSpace(v)
+        switch k {
+        case "Autosave-Reason":
+            n.Reason = v
+        case "Autosave-Session":
+            n.Session, n.Part, _ = strings.Cut(v, " ")
+        case "Autosave-Trigger":
+            reason, detail, _ := strings.Cut(v, " (")
+            n.Reason, n.Trigger = firstNonEmpty(n.Reason, reason), strings.TrimSuffix(detail, ")")
+        }
+    }
+    return n, ok
+}
+
+// FileStat is one file's line counts in a commit; binary files count as 0.
+type FileStat struct {
+    Path    string
+    Added   int
+    Removed int
+}
+
+// DiffStats returns per-file line counts for each commit, diffed against its
+// first parent.
+func DiffStats(repo string, hashes []string) (map[string][]FileStat, error) {
+    stats := map[string][]FileStat{}
+    if len(hashes) == 0 { return stats, nil }
+    args := append([]string{"log", "--no-walk=unsorted", "--diff-merges=first-parent", "--numstat", "--format=%x1e%H"}, hashes...)
+    out, err := runOut(repo, "git", args...)
+    if err != nil { return nil, fmt.Errorf("git log --numstat (%s): %w", repo, err) }
+    for _, rec := range strings.Split(out, "\x1e") {
+        lines := strings.Split(strings.TrimSpace(rec), "\n")
+        if len(lines) == 0 || lines[0] == "" { continue }
+        var list []FileStat
+        for _, l := range lines[1:] {
+            f := strings.SplitN(l, "\t", 3)
+            if len(f) < 3 { continue }
+            st := FileStat{Path: f[2]}
+            fmt.Sscanf(f[0], "%d", &st.Added)
+            fmt.Sscanf(f[1], "%d", &st.Removed)
+            list = append(list, st)
+        }
+        stats[lines[0]] = list
+    }
+    return stats, nil
+}
@@ -0,0 +1,54 @@
+package gitops
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestNotesRoundTrip(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "by hand")
+    first := testutil.Commit(t, root, "a.txt", "a\n", "autosave 1")
+    second := testutil.Commit(t, root, "b.txt", "b\n", "autosave 2")
+
+    start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+    want := Note{Reason: "idle", Paths: []string{"a.txt"}, BatchStart: start, BatchEnd: start.Add(time.Minute), Host: "box", Events: 3, Version: "v1"}
+    if err := WriteNote(root, first, want); err != nil { t.Fatal(err) }
+    if err := WriteNote(root, second, Note{Reason: "batch", Paths: []string{"b.txt"}}); err != nil { t.Fatal(err) }
+
+    got, found, err := ReadNote(root, first)
+    if err != nil || !found || !reflect.DeepEqual(got, want) { t.Errorf("ReadNote = %+v, %v, %v; want %+v", got, found, err, want) }
+    if _, found, err := ReadNote(root, "HEAD~2"); found || err != nil { t.Errorf("unnoted commit: found %v, %v", found, err) }
+    if n, _, _ := ReadNote(root, second); n.Version != Version || n.Host == "" { t.Errorf("defaults not filled in: %+v", n) }
+
+    list, err := Autosaves(root, time.Time{}, 0)
+    if err != nil { t.Fatal(err) }
+    if len(list) != 2 || list[0].Hash != second || list[1].Hash != first || list[1].Subject != "autosave 1" || list[1].Note.Events != 3 {
+        t.Errorf("Autosaves = %+v", list)
+    }
+    if list, _ := Autosaves(root, time.Time{}, 1); len(list) != 1 { t.Errorf("limit 1 gave %d", len(list)) }
+}
+
+func TestFailedNoteKeepsTheCommit(t *testing.T) {
+    root := testutil.NewRepo(t)
+    base := testutil.Commit(t, root, "README", "hi\n", "init")
+    // a stale lock makes git notes fail
+    lock := filepath.Join(root, ".git", "refs", "notes", "autogit.lock")
+    os.MkdirAll(filepath.Dir(lock), 0o755)
+    os.WriteFile(lock, nil, 0o644)
+
+    testutil.Write(t, root, "a.txt", "a\n")
+    msg, err := CommitAndMaybePush(config.DefaultRepo(root), []string{"a.txt"}, Note{Reason: "idle"})
+    var ne *NoteError
+    if !errors.As(err, &ne) { t.Errorf("err = %v, want a *NoteError", err) }
+    if msg == "" || testutil.Git(t, root, "rev-parse", "HEAD^") != base {
+        t.Errorf("autosave lost: message %q, HEAD^ %s", msg, testutil.Git(t, root, "rev-parse", "HEAD^"))
+    }
+}
@@ -0,0 +1,85 @@
+package gitops
+
+import (
+    "sort"
+    "strings"
+)
+
+// diffRenames runs a rename-detecting name-status diff and returns what git
+// considers moved (old -> new) plus the plain additions and deletions.
+func diffRenames(repo string, env []string, args ...string) (renames map[string]string, added, deleted map[string]bool, err error) {
+    args = append(args, "-M", "--name-status", "-z", "--relative")
+    out, err := runEnv(repo, env, args...)
+    if err != nil { return nil, nil, nil, err }
+    renames, added, deleted = map[string]string{}, map[string]bool{}, map[string]bool{}
+    f := strings.Split(out, "\x00")
+    for i := 0; i+1 < len(f); i += 2 {
+        switch code := f[i]; {
+        case strings.HasPrefix(code, "R") && i+2 < len(f):
+            renames[f[i+1]] = f[i+2]
+            i++
+        case strings.HasPrefix(code, "C"):
+            i++
+        case code == "A":
+            added[f[i+1]] = true
+        case code == "D":
+            deleted[f[i+1]] = true
+        }
+    }
+    return renames, added, deleted, nil
+}
+
+// reconcileRenames reconciles the moves the watcher paired with what git sees.
+// Git's renames are kept; a watcher pair git doesn't call a rename is kept
+// when git still sees old deleted and new added (a move with heavy edits);
+// pairs git contradicts are dropped.
+func reconcileRenames(seen, renames map[string]string, added, deleted map[string]bool) map[string]string {
+    out := map[string]string{}
+    for o, n := range renames { out[o] = n }
+    for o, n := range seen {
+        if _, ok := out[o]; ok { continue }
+        if deleted[o] && added[n] { out[o] = n }
+    }
+    if len(out) == 0 { return nil }
+    return out
+}
+
+// confirmRenames checks the watcher's pairs against a diff; on error they are
+// dropped rather than trusted.
+func confirmRenames(seen map[string]string, repo string, env []string, args ...string) map[string]string {
+    renames, added, deleted, err := diffRenames(repo, env, args...)
+    if err != nil { return nil }
+    return reconcileRenames(seen, renames, added, deleted)
+}
+
+// listRenames renders up to max moves as "old → new".
+func listRenames(renames map[string]string, max int) string {
+    olds := make([]string, 0, len(renames))
+    for o := range renames { olds = append(olds, o) }
+    sort.Strings(olds)
+    items := make([]string, 0, len(olds))
+    for _, o := range olds { items = append(items, o+" → "+renames[o]) }
+    return listFiles(items, max)
+}
+
+// withRenames folds each move in files into a single "old → new" entry.
+func withRenames(files []string, renames map[string]string) []string {
+    if len(renames) == 0 { return files }
+    in := make(map[string]bool, len(files))
+    for _, f := range files { in[f] = true }
+    targets := make(map[string]string, len(renames))
+    for o, n := range renames { targets[n] = o }
+    out := make([]string, 0, len(files))
+    for _, f := range files {
+        if n, ok := renames[f]; ok {
+            out = append(out, f+" → "+n)
+        } else if o, ok := targets[f]; ok && in[o] {
+            continue
+        } else if ok {
+            out = append(out, o+" → "+f)
+        } else {
+            out = append(out, f)
+        }
+    }
+    return out
+}
@@ -0,0 +1,215 @@
+package gitops
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "os"
+    "os/exec"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/whrit/autoGit/internal/config"
+)
+
+// defaultSplitBytes bounds each commit with split_commits: size when
+// split_bytes is unset.
+const defaultSplitBytes = 50 << 20
+
+// commitSeries commits the difference between parents[0] and the index in
+// env as an ordered series of commits chunked per rc.SplitCommits, all sharing
+// one Autosave-Session trailer, and then moves ref from old to the last of
+// them; ref only moves once every part is built. With split_commits: size and
+// push on, every part but the last is then pushed on its own so no push
+// exceeds the limit. It reports false, having done nothing, when the changes
+// fit in one commit. git commit hooks don't run for split autosaves.
+func commitSeries(rc config.RepoConfig, env []string, ref, old, branch string, parents []string, note Note) (string, bool, error) {
+    top, err := runEnv(rc.Path, nil, "rev-parse", "--show-toplevel")
+    if err != nil { return "", false, err }
+    out, err := runEnv(top, env, "diff-index", "--cached", "-z", "--name-only", "--no-renames", parents[0])
+    if err != nil { return "", false, err }
+    staged, err := runEnv(top, env, "ls-files", "-s", "-z")
+    if err != nil { return "", false, err }
+    entries := map[string]string{} // path -> "mode sha"
+    for _, l := range splitNul(staged) {
+        if meta, p, ok := strings.Cut(l, "\t"); ok { entries[p] = meta[:strings.LastIndexByte(meta, ' ')] }
+    }
+    changed := splitNul(out)
+    var sizes map[string]int64
+    if rc.SplitCommits == "size" {
+        if sizes, err = blobSizes(top, entries, changed); err != nil { return "", false, err }
+    }
+    chunks := chunkPaths(rc, sizes, changed)
+    if len(chunks) < 2 { return "", false, nil }
+
+    // every part is built before ref moves, so a failure part way leaves
+    // ref as it was rather than pointing into a partial series
+    session := sessionID()
+    shas, msgs, parts := make([]string, len(chunks)), make([]string, len(chunks)), make([]Note, len(chunks))
+    for i, chunk := range chunks {
+        tree, err := chunkTree(top, parents[0], chunk, entries)
+        if err != nil { return "", true, fmt.Errorf("part %d/%d, nothing committed: %w", i+1, len(chunks), err) }
+        part := partNote(note, chunk, i == 0)
+        part.Session, part.Part = session, fmt.Sprintf("%d/%d", i+1, len(chunks))
+        msg := buildMessage(rc, chunk, part)
+        args := []string{"commit-tree", tree, "-m", msg}
+        for _, p := range parents { args = append(args, "-p", p) }
+        if rc.Sign { args = append(args, "-S") }
+        if len(rc.SignArgs) > 0 { args = append(args, rc.SignArgs...) }
+        sha, err := runEnv(rc.Path, nil, args...)
+        if err != nil { return "", true, fmt.Errorf("part %d/%d, nothing committed: %w", i+1, len(chunks), err) }
+        if ref != "HEAD" { part.Target = ref }
+        shas[i], msgs[i], parts[i] = sha, msg, part
+        parents = []string{sha}
+    }
+    msg := strings.Join(msgs, "\n")
+    if _, err := runEnv(rc.Path, nil, "update-ref", "-m", "autoGit: "+note.Reason, ref, parents[0], old); err != nil {
+        return "", true, err
+    }
+
+    var noteErr error
+    for i, sha := range shas {
+        if err := WriteNote(rc.Path, sha, parts[i]); err != nil && noteErr == nil { noteErr = &NoteError{Rev: sha, Err: err} }
+    }
+    if rc.Push && rc.SplitCommits == "size" && branch != "" {
+        // the caller pushes the last part
+        for i, sha := range shas[:len(shas)-1] {
+            if err := mustRun(rc.Path, "git", "push", firstNonEmpty(rc.Remote, "origin"), sha+":refs/heads/"+branch); err != nil {
+                return msg, true, fmt.Errorf("pushing part %d/%d (committed locally; the next push sends it): %w", i+1, len(shas), err)
+            }
+        }
+    }
+    return msg, true, noteErr
+}
+
+// chunkPaths groups changed paths into the commits of a series: one per
+// top-level directory, files at the top first, or runs whose staged blobs
+// (sizes, uncompressed; deleted paths count as nothing) stay within the byte
+// limit. A single file over the limit gets a commit of its own.
+func chunkPaths(rc config.RepoConfig, sizes map[string]int64, paths []string) [][]string {
+    sort.Strings(paths)
+    var chunks [][]string
+    switch rc.SplitCommits {
+    case "directory":
+        byDir := map[string][]string{}
+        var dirs []string
+        for _, p := range paths {
+            dir, _, nested := strings.Cut(p, "/")
+            if !nested { dir = "" }
+            if byDir[dir] == nil { dirs = append(dirs, dir) }
+            byDir[dir] = append(byDir[dir], p)
+        }
+        sort.Strings(dirs)
+        for _, d := range dirs { chunks = append(chunks, byDir[d]) }
+    case "size":
+        limit := rc.SplitBytes
+        if limit <= 0 { limit = defaultSplitBytes }
+        var cur []string
+        var size int64
+        for _, p := range paths {
+            n := sizes[p]
+            if len(cur) > 0 && size+n > limit {
+                chunks, cur, size = append(chunks, cur), nil, 0
+            }
+            cur, size = append(cur, p), size+n
+        }
+        if len(cur) > 0 { chunks = append(chunks, cur) }
+    }
+    return chunks
+}
+
+// blobSizes returns the size of the staged blob of each of paths, as git
+// stores it before compression; entries maps paths to "mode sha". Deleted
+// paths and gitlinks have none.
+func blobSizes(top string, entries map[string]string, changed []string) (map[string]int64, error) {
+    var paths []string
+    var in bytes.Buffer
+    for _, p := range changed {
+        mode, sha, _ := strings.Cut(entries[p], " ")
+        if sha == "" || mode == "160000" { continue }
+        paths = append(paths, p)
+        fmt.Fprintln(&in, sha)
+    }
+    sizes := make(map[string]int64, len(paths))
+    if len(paths) == 0 { return sizes, nil }
+    cmd := exec.Command("git", "cat-file", "--batch-check=%(objectsize)")
+    var out, stderr bytes.Buffer
+    cmd.Dir, cmd.Stdin, cmd.Stdout, cmd.Stderr = top, &in, &out, &stderr
+    if err := run(cmd); err != nil {
+        return nil, fmt.Errorf("git cat-file: %w (%s)", err, strings.TrimSpace(stderr.String()))
+    }
+    for i, f := range strings.Fields(out.String()) {
+        if i >= len(paths) { break }
+        n, err := strconv.ParseInt(f, 10, 64)
+        if err != nil { return nil, fmt.Errorf("git cat-file: size of %s: %q", paths[i], f) }
+        sizes[paths[i]] = n
+    }
+    return sizes, nil
+}
+
+// chunkTree returns the tree of parent with paths (relative to top) set to
+// their staged entries, or removed when they aren't staged.
+func chunkTree(top, parent string, paths []string, entries map[string]string) (string, error) {
+    idx, err := os.CreateTemp("", "autogit-index-*")
+    if err != nil { return "", err }
+    idx.Close()
+    os.Remove(idx.Name())
+    defer os.Remove(idx.Name())
+    env := []string{"GIT_INDEX_FILE=" + idx.Name()}
+    if _, err := runEnv(top, env, "read-tree", parent); err != nil { return "", err }
+    var info bytes.Buffer
+    for _, p := range paths {
+        meta, ok := entries[p]
+        if !ok { meta = "0 0000000000000000000000000000000000000000" }
+        fmt.Fprintf(&info, "%s\t%s\x00", meta, p)
+    }
+    cmd := exec.Command("git", "update-index", "-z", "--index-info")
+    var out bytes.Buffer
+    cmd.Dir, cmd.Env, cmd.Stdin, cmd.Stdout, cmd.Stderr = top, append(os.Environ(), env...), &info, &out, &out
+    if err := run(cmd); err != nil {
+        return "", fmt.Errorf("git update-index: %w (%s)", err, strings.TrimSpace(out.String()))
+    }
+    return runEnv(top, env, "write-tree")
+}
+
+// partNote narrows n to one part of a series. Event counts stay with the
+// first part so reports don't count them once per part.
+func partNote(n Note, paths []string, first bool) Note {
+    part := n
+    part.Paths, part.Ops, part.Renames = paths, nil, nil
+    in := make(map[string]bool, len(paths))
+    for _, p := range paths { in[p] = true }
+    for p, op := range n.Ops {
+        if in[p] {
+            if part.Ops == nil { part.Ops = map[string]string{} }
+            part.Ops[p] = op
+        }
+    }
+    for o, nw := range n.Renames {
+        if in[nw] {
+            if part.Renames == nil { part.Renames = map[string]string{} }
+            part.Renames[o] = nw
+        }
+    }
+    if !first { part.Events, part.Suppressed = 0, 0 }
+    return part
+}
+
+// splitting reports whether rc asks for split autosaves.
+func splitting(rc config.RepoConfig) bool { return rc.SplitCommits == "directory" || rc.SplitCommits == "size" }
+
+func sessionID() string {
+    b := make([]byte, 6)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+func splitNul(s string) []string {
+    var out []string
+    for _, f := range strings.Split(s, "\x00") {
+        if f != "" { out = append(out, f) }
+    }
+    return out
+}
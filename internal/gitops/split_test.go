@@ -0,0 +1,134 @@
+package gitops
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/whrit/autoGit/internal/config"
+    "github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestChunkPaths(t *testing.T) {
+    sizes := map[string]int64{"README": 10, "a/x.go": 40, "a/y.go": 40, "b/big.bin": 500, "b/z.go": 30, "c/w.go": 60}
+    paths := []string{"c/w.go", "b/z.go", "a/y.go", "README", "b/big.bin", "a/x.go", "gone.txt"}
+
+    cases := []struct {
+        name  string
+        split string
+        limit int64
+        want  [][]string
+    }{
+        {"directory", "directory", 0, [][]string{{"README", "gone.txt"}, {"a/x.go", "a/y.go"}, {"b/big.bin", "b/z.go"}, {"c/w.go"}}},
+        {"size", "size", 100, [][]string{{"README", "a/x.go", "a/y.go"}, {"b/big.bin"}, {"b/z.go", "c/w.go", "gone.txt"}}},
+        {"file over the limit alone", "size", 20, [][]string{{"README"}, {"a/x.go"}, {"a/y.go"}, {"b/big.bin"}, {"b/z.go"}, {"c/w.go"}, {"gone.txt"}}},
+        {"everything fits", "size", 1 << 20, [][]string{{"README", "a/x.go", "a/y.go", "b/big.bin", "b/z.go", "c/w.go", "gone.txt"}}},
+        {"none", "none", 0, nil},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            rc := config.RepoConfig{SplitCommits: tc.split, SplitBytes: tc.limit}
+            if got := chunkPaths(rc, sizes, append([]string(nil), paths...)); !reflect.DeepEqual(got, tc.want) {
+                t.Errorf("got %q, want %q", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestBlobSizes(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "gone.txt", "bye\n", "init")
+    testutil.Write(t, root, "a.txt", "0123456789")
+    testutil.Git(t, root, "add", "a.txt")
+    testutil.Write(t, root, "a.txt", strings.Repeat("x", 1000)) // the worktree moved on
+    testutil.Git(t, root, "rm", "-q", "gone.txt")
+
+    entries := map[string]string{}
+    for _, l := range strings.Split(testutil.Git(t, root, "ls-files", "-s"), "\n") {
+        meta, p, _ := strings.Cut(l, "\t")
+        entries[p] = meta[:strings.LastIndexByte(meta, ' ')]
+    }
+    got, err := blobSizes(root, entries, []string{"a.txt", "gone.txt"})
+    if err != nil { t.Fatal(err) }
+    if want := map[string]int64{"a.txt": 10}; !reflect.DeepEqual(got, want) { t.Errorf("got %v, want %v", got, want) }
+}
+
+func TestPartNote(t *testing.T) {
+    n := Note{
+        Reason:     "batch",
+        Paths:      []string{"a.go", "b.go", "new.go"},
+        Ops:        map[string]string{"a.go": "write", "b.go": "create", "new.go": "rename"},
+        Renames:    map[string]string{"old.go": "new.go"},
+        Events:     9,
+        Suppressed: 2,
+        Deferred:   []string{"c.bin"},
+    }
+    cases := []struct {
+        name  string
+        paths []string
+        first bool
+        want  Note
+    }{
+        {"first part keeps the counts", []string{"a.go"}, true, Note{Reason: "batch", Paths: []string{"a.go"}, Ops: map[string]string{"a.go": "write"}, Events: 9, Suppressed: 2, Deferred: []string{"c.bin"}}},
+        {"later part", []string{"b.go", "new.go"}, false, Note{Reason: "batch", Paths: []string{"b.go", "new.go"}, Ops: map[string]string{"b.go": "create", "new.go": "rename"}, Renames: map[string]string{"old.go": "new.go"}, Deferred: []string{"c.bin"}}},
+        {"no ops", []string{"d.go"}, false, Note{Reason: "batch", Paths: []string{"d.go"}, Deferred: []string{"c.bin"}}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := partNote(n, tc.paths, tc.first); !reflect.DeepEqual(got, tc.want) {
+                t.Errorf("got %+v, want %+v", got, tc.want)
+            }
+        })
+    }
+    if len(n.Ops) != 3 || n.Events != 9 { t.Errorf("partNote changed its input: %+v", n) }
+}
+
+func TestCommitSeriesPushesPartsAfterRef(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    remote := t.TempDir()
+    testutil.Git(t, remote, "init", "-q", "--bare")
+    testutil.Git(t, root, "remote", "add", "origin", remote)
+    testutil.Git(t, root, "push", "-q", "-u", "origin", "work")
+    testutil.Write(t, root, "a/x.go", strings.Repeat("x", 80))
+    testutil.Write(t, root, "b/y.go", strings.Repeat("y", 80))
+
+    rc := config.DefaultRepo(root)
+    rc.SplitCommits, rc.SplitBytes, rc.Push = "size", 100, true
+    if _, err := CommitAndMaybePush(rc, nil, Note{Reason: "batch"}); err != nil { t.Fatal(err) }
+
+    if n := testutil.Git(t, root, "rev-list", "--count", "work"); n != "3" { t.Errorf("work has %s commits, want 3", n) }
+    if got, want := testutil.Git(t, remote, "rev-parse", "work"), testutil.Git(t, root, "rev-parse", "work"); got != want {
+        t.Errorf("remote at %s, want %s", got, want)
+    }
+    for _, rev := range []string{"work~1", "work"} {
+        if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", rev); !strings.Contains(out, `"session"`) {
+            t.Errorf("%s note = %s", rev, out)
+        }
+    }
+}
+
+func TestCommitSeriesKeepsPartsWhenPushFails(t *testing.T) {
+    root := testutil.NewRepo(t)
+    testutil.Commit(t, root, "README", "hi\n", "init")
+    remote := t.TempDir()
+    testutil.Git(t, remote, "init", "-q", "--bare")
+    testutil.Git(t, root, "remote", "add", "origin", remote)
+    testutil.Git(t, root, "push", "-q", "-u", "origin", "work")
+    hook := filepath.Join(remote, "hooks", "pre-receive")
+    if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil { t.Fatal(err) }
+    testutil.Write(t, root, "a/x.go", strings.Repeat("x", 80))
+    testutil.Write(t, root, "b/y.go", strings.Repeat("y", 80))
+
+    rc := config.DefaultRepo(root)
+    rc.SplitCommits, rc.SplitBytes, rc.Push = "size", 100, true
+    _, err := CommitAndMaybePush(rc, nil, Note{Reason: "batch"})
+    if err == nil || !strings.Contains(err.Error(), "pushing part 1/2") { t.Errorf("err = %v, want the failed part named", err) }
+
+    // the whole series stands locally, notes and all
+    if n := testutil.Git(t, root, "rev-list", "--count", "work"); n != "3" { t.Errorf("work has %s commits, want 3", n) }
+    if got := testutil.Git(t, root, "status", "--porcelain"); got != "" { t.Errorf("left uncommitted: %q", got) }
+    if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", "work~1"); !strings.Contains(out, `"part":"1/2"`) { t.Errorf("first part note = %s", out) }
+}
@@ -0,0 +1,19 @@
+package logs
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// debug is set from the config by Setup and on reload.
+var debug atomic.Bool
+
+// SetDebug turns debug logging on or off.
+func SetDebug(on bool) { debug.Store(on) }
+
+// Debugf logs only when debug logging is on.
+func Debugf(format string, args ...any) {
+	if debug.Load() {
+		log.Printf("[DEBUG] "+format, args...)
+	}
+}
@@ -10,6 +10,7 @@ import (
 )
 
 func Setup(cfg config.Config) error {
+	debug.Store(cfg.Debug)
 	if cfg.LogPath == "" {
 		// leave default logger to stderr
 		return nil
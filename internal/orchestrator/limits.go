@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/watch"
+)
+
+// overLimit describes which of max_batch_files and max_batch_bytes b has
+// reached, or returns "" while it is within both.
+func overLimit(rc config.RepoConfig, b watch.Batch) string {
+	if rc.MaxBatchFiles > 0 && len(b.Paths) >= rc.MaxBatchFiles {
+		return fmt.Sprintf("%d files, max_batch_files %d", len(b.Paths), rc.MaxBatchFiles)
+	}
+	if rc.MaxBatchBytes > 0 {
+		if n := batchBytes(rc.Path, b); n >= rc.MaxBatchBytes {
+			return fmt.Sprintf("%d bytes, max_batch_bytes %d", n, rc.MaxBatchBytes)
+		}
+	}
+	return ""
+}
+
+// batchBytes adds up the current sizes of b's files; removed paths count
+// as nothing.
+func batchBytes(root string, b watch.Batch) int64 {
+	var n int64
+	for rel := range b.Paths {
+		if fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rel))); err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+	"github.com/whrit/autoGit/internal/watch"
+)
+
+func TestOverLimit(t *testing.T) {
+	root := t.TempDir()
+	testutil.Write(t, root, "a.txt", "12345")
+	testutil.Write(t, root, "src/b.txt", "1234567890")
+	b := watch.Batch{Paths: map[string]watch.Op{"a.txt": watch.Write, "src/b.txt": watch.Write, "gone.txt": watch.Remove}}
+
+	rc := config.DefaultRepo(root)
+	if got := overLimit(rc, b); got != "" {
+		t.Errorf("no limits: %q", got)
+	}
+	rc.MaxBatchFiles = 3
+	if got := overLimit(rc, b); got != "3 files, max_batch_files 3" {
+		t.Errorf("max_batch_files: %q", got)
+	}
+	rc.MaxBatchFiles, rc.MaxBatchBytes = 4, 16
+	if got := overLimit(rc, b); got != "" {
+		t.Errorf("15 bytes tripped max_batch_bytes 16: %q", got)
+	}
+	rc.MaxBatchBytes = 15
+	if got := overLimit(rc, b); got != "15 bytes, max_batch_bytes 15" {
+		t.Errorf("max_batch_bytes: %q", got)
+	}
+}
@@ -0,0 +1,43 @@
+package orchestrator
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/watch"
+)
+
+// adoptNested adds an entry for every repository nested inside a repo with
+// nested_repos: adopt. The nested entry inherits the parent's settings except
+// includes, which are relative to the parent; repos that are configured
+// explicitly keep their own entry.
+func adoptNested(repos []config.RepoConfig) []config.RepoConfig {
+	seen := map[string]bool{}
+	for _, rc := range repos {
+		seen[filepath.Clean(rc.Path)] = true
+	}
+	out := append([]config.RepoConfig(nil), repos...)
+	for i := 0; i < len(out); i++ { // appended entries are searched too
+		rc := out[i]
+		if rc.NestedRepos != "adopt" {
+			continue
+		}
+		found, err := watch.NestedRepos(rc)
+		if err != nil {
+			log.Printf("[WARN] nested repos (%s): %v", rc.Path, err)
+			continue
+		}
+		for _, dir := range found {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			child := rc
+			child.Path, child.Includes = dir, nil
+			out = append(out, child)
+			log.Printf("[INFO] adopted nested repository %s (inside %s)", dir, rc.Path)
+		}
+	}
+	return out
+}
@@ -1,44 +1,84 @@
 package orchestrator
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/whrit/autoGit/internal/backup"
 	"github.com/whrit/autoGit/internal/config"
 	"github.com/whrit/autoGit/internal/gitops"
 	"github.com/whrit/autoGit/internal/theme"
 	"github.com/whrit/autoGit/internal/watch"
 )
 
-// Run starts workers for all repos and blocks until they exit.
-func Run(cfg config.Config, t theme.Theme) {
-	var wg sync.WaitGroup
-	for _, rc := range cfg.Repos {
-		rc := rc
-		wg.Add(1)
-		go func() { defer wg.Done(); runRepo(rc, t) }()
+// headPoll is how often each worker checks whether HEAD moved to another branch.
+const headPoll = time.Second
+
+// Run starts workers for all repos and keeps them in step with the config
+// file, which is reloaded when it changes or on SIGHUP. Once ctx is cancelled
+// every worker commits what it has pending and stops; Run gives them
+// cfg.ShutdownTimeout to do so.
+func Run(ctx context.Context, cfg config.Config, t theme.Theme) {
+	s := &supervisor{ctx: ctx, t: t, workers: map[string]*worker{}}
+	s.apply(cfg.Repos)
+	reload := reloads(ctx, config.Path())
+	for ctx.Err() == nil {
+		select {
+		case <-reload:
+			s.reload(&cfg)
+		case <-ctx.Done():
+		}
+	}
+	done := make(chan struct{})
+	go func() { s.wg.Wait(); close(done) }()
+	deadline := firstDur(cfg.ShutdownTimeout, defaultShutdownTimeout)
+	select {
+	case <-done:
+		log.Printf("[INFO] shutdown complete")
+	case <-time.After(deadline):
+		log.Printf("[WARN] shutdown took longer than %s; exiting with work in progress", deadline)
+		for _, op := range gitops.Abort(time.Second) {
+			log.Printf("[WARN] cut off: %s", op)
+		}
 	}
-	wg.Wait()
 }
 
-func runRepo(rc config.RepoConfig, t theme.Theme) {
+// defaultShutdownTimeout bounds the final flush when shutdown_timeout is unset.
+const defaultShutdownTimeout = 10 * time.Second
+
+func runRepo(ctx context.Context, rc config.RepoConfig, t theme.Theme) {
 	if !gitops.IsGitRepo(rc.Path) {
 		log.Printf("[WARN] not a git repo: %s", rc.Path)
 		return
 	}
+	if _, unknown := rc.NoisePatterns(); len(unknown) > 0 {
+		log.Printf("[WARN] unknown noise_profiles (%s): %v", rc.Path, unknown)
+	}
+
+	// Batching state: a group per path rule plus one for the other paths.
+	// Interval, storm, startup and rescan commits take all of them at once.
+	groups, debounceMS := newGroups(rc)
+	rest := groups[len(groups)-1]
+	whole := rc
+	whole.PathRules = nil
 
 	// Event stream
-	var (
-		changes <-chan string
-		stop    func()
-	)
+	var changes <-chan watch.Batch
 	if rc.Watch {
-		ch, st, err := watch.Start(rc)
+		wrc := rc
+		wrc.DebounceMS = debounceMS
+		ch, stop, err := watch.Start(wrc)
 		if err != nil {
 			log.Printf("[ERROR] watch: %v", err)
 		} else {
-			changes, stop = ch, st
+			changes = ch
+			defer stop()
 		}
 	}
 
@@ -49,83 +89,607 @@ func runRepo(rc config.RepoConfig, t theme.Theme) {
 	if rc.Interval > 0 {
 		ticker = time.NewTicker(rc.Interval)
 	}
+	var backupTicker *time.Ticker
+	if rc.Backup.Dir != "" && rc.Backup.Interval > 0 {
+		backupTicker = time.NewTicker(rc.Backup.Interval)
+		defer backupTicker.Stop()
+	}
+
+	// HEAD tracking: a checkout must not carry a batch over to another branch
+	gitDir, err := gitops.GitDir(rc.Path)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		return
+	}
+	head, headRaw := gitops.ReadHead(rc.Path), gitops.HeadFile(gitDir)
+	headTicker := time.NewTicker(headPoll)
+	defer headTicker.Stop()
 
-	// Batching state
-	set := map[string]struct{}{}
 	var (
-		batchTimer *time.Timer
-		idleTimer  *time.Timer
-		mu         sync.Mutex
+		storm stormState // bulk operation in progress
+		mu    sync.Mutex
 	)
+	// entries scoped to parts of the same repo share one lock so their git
+	// operations never race
+	gitMu := repoLock(gitDir)
+	// one backup at a time per repository; a worker waits for its own
+	// before it returns
+	backupMu := repoLock(gitDir + " backup")
+	var backups sync.WaitGroup
+	defer backups.Wait()
+
+	// peek lists the paths pending in gs without taking them.
+	peek := func(gs ...*group) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var batch watch.Batch
+		for _, g := range gs {
+			batch.Merge(g.batch)
+		}
+		return batch.Sorted()
+	}
 
-	flush := func(reason string) {
+	// take empties gs and returns what they held.
+	take := func(gs ...*group) watch.Batch {
 		mu.Lock()
-		files := make([]string, 0, len(set))
-		for f := range set {
-			files = append(files, f)
+		defer mu.Unlock()
+		var batch watch.Batch
+		for _, g := range gs {
+			batch.Merge(g.batch)
+			g.batch = watch.Batch{}
+			g.full = false
+			g.stopTimers()
+		}
+		return batch
+	}
+
+	// carried maps the paths committed to the previous branch at the last
+	// checkout to the content committed. They are still dirty on the new
+	// branch; its autosaves leave them out until they are edited again.
+	// Guarded by gitMu.
+	carried := map[string]string{}
+
+	// checkHead detects branch switches; callers hold gitMu.
+	checkHead := func() {
+		raw := gitops.HeadFile(gitDir)
+		if raw == headRaw {
+			return
 		}
-		set = map[string]struct{}{}
-		if batchTimer != nil {
-			batchTimer.Stop()
-			batchTimer = nil
+		headRaw = raw
+		old, cur := head, gitops.ReadHead(rc.Path)
+		head = cur
+		if !gitops.Switched(rc.Path, old, cur) {
+			return
 		}
-		if idleTimer != nil {
-			idleTimer.Stop()
-			idleTimer = nil
+		log.Printf("[INFO] HEAD moved (%s): %s → %s", rc.Path, describeHead(old), describeHead(cur))
+		carried = map[string]string{}
+		if b := take(groups...); !b.Empty() {
+			if kept := attribute(rc, old, cur, b.Sorted(), noteFor("branch-switch", b)); len(kept) > 0 {
+				carried = gitops.BlobIDs(rc.Path, kept)
+			}
 		}
-		mu.Unlock()
+	}
+
+	// carriedOver returns the carried paths still as they were committed and
+	// forgets the rest; callers hold gitMu.
+	carriedOver := func() []string {
+		if len(carried) == 0 {
+			return nil
+		}
+		paths := make([]string, 0, len(carried))
+		for p := range carried {
+			paths = append(paths, p)
+		}
+		var same []string
+		for p, id := range gitops.BlobIDs(rc.Path, paths) {
+			if id == carried[p] {
+				same = append(same, p)
+			} else {
+				delete(carried, p)
+			}
+		}
+		sort.Strings(same)
+		return same
+	}
+
+	// requeue is set below, next to the timers it rearms.
+	var requeue func(b *watch.Batch, busy []string) watch.Batch
+
+	// closed is set by the final flush on shutdown or reload; timers firing
+	// later find nothing to do. Guarded by gitMu.
+	closed := false
+
+	// deferredSince is when each path was first held back as still being
+	// written; one written to without pause is committed after maxDefer
+	// anyway. Guarded by gitMu.
+	deferredSince := map[string]time.Time{}
+
+	// overdue returns the busy paths that may wait longer, warning about the
+	// rest; callers hold gitMu.
+	overdue := func(busy []string) []string {
+		now := time.Now()
+		var wait, late []string
+		for _, p := range busy {
+			since, ok := deferredSince[p]
+			if !ok {
+				deferredSince[p] = now
+			} else if now.Sub(since) >= maxDefer {
+				late = append(late, p)
+				continue
+			}
+			wait = append(wait, p)
+		}
+		if len(late) > 0 {
+			log.Printf("[WARN] committing %d file(s) still being written after %s (%s): %s", len(late), maxDefer, rc.Path, strings.Join(late, ", "))
+		}
+		return wait
+	}
+
+	// flush commits the paths pending in gs within scope's reach.
+	flush := func(reason string, scope config.RepoConfig, gs ...*group) {
+		final := reason == "shutdown" || reason == "reload"
+		// probed before taking gitMu so other entries of the repo can
+		// commit meanwhile; the final flush doesn't wait for writers
+		var busy []string
+		if !final {
+			busy = watch.Busy(rc.Path, peek(gs...), rc.WriteProbe)
+		}
+		gitMu.Lock()
+		defer gitMu.Unlock()
+		if closed {
+			return
+		}
+		closed = final
+		checkHead()
+		batch := take(gs...)
+		var trigger string
+		if reason == "size" {
+			trigger = overLimit(scope, batch)
+		}
+		var held watch.Batch
+		if busy = overdue(busy); len(busy) > 0 {
+			// files still being copied or exported wait for the next flush
+			held = requeue(&batch, busy)
+			if len(held.Paths) > 0 {
+				log.Printf("[INFO] deferring %d file(s) still being written (%s): %s", len(held.Paths), rc.Path, strings.Join(held.Sorted(), ", "))
+			}
+		}
+		for p := range batch.Paths {
+			delete(deferredSince, p)
+		}
+		left := carriedOver()
+		if len(left) > 0 {
+			isLeft := make(map[string]bool, len(left))
+			for _, p := range left {
+				isLeft[p] = true
+			}
+			batch = batch.Split(func(rel string) int {
+				if isLeft[rel] {
+					return 1
+				}
+				return 0
+			})[0]
+		}
+		files, note := batch.Sorted(), noteFor(reason, batch)
+		note.Deferred, note.Trigger, note.Carried = held.Sorted(), trigger, left
 
 		if len(files) == 0 && rc.Interval == 0 {
 			return
 		}
 
-		msg, err := gitops.CommitAndMaybePush(rc, files)
-		if err != nil {
-			log.Printf("[ERROR] commit (%s): %v", rc.Path, err)
+		commit(scope, files, note)
+	}
+	flushAll := func(reason string) { flush(reason, whole, groups...) }
+
+	// startTimers arms g's batch and idle timers; callers hold mu.
+	startTimers := func(g *group) {
+		if g.rc.BatchWindow > 0 && g.batchTimer == nil {
+			g.batchTimer = time.AfterFunc(g.rc.BatchWindow, func() { flush("batch", g.rc, g) })
+		}
+		if g.rc.IdleWindow > 0 {
+			if g.idleTimer != nil {
+				g.idleTimer.Stop()
+			}
+			g.idleTimer = time.AfterFunc(g.rc.IdleWindow, func() { flush("idle", g.rc, g) })
+		}
+	}
+
+	// arm starts g's timers once its own debounce has passed; callers hold mu.
+	arm := func(g *group) {
+		if g.settle <= 0 {
+			startTimers(g)
 			return
 		}
-		if msg != "" {
-			log.Printf("[OK] committed (%s): %s", rc.Path, msg)
+		if g.settleTimer != nil {
+			g.settleTimer.Stop()
+		}
+		g.settleTimer = time.AfterFunc(g.settle, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !storm.active() && !g.batch.Empty() {
+				startTimers(g)
+			}
+		})
+	}
+
+	// requeue moves busy paths out of b back into their groups and returns
+	// them; a move goes along with its new path.
+	requeue = func(b *watch.Batch, busy []string) watch.Batch {
+		isBusy := make(map[string]bool, len(busy))
+		for _, p := range busy {
+			isBusy[p] = true
 		}
+		parts := b.Split(func(rel string) int {
+			if isBusy[rel] {
+				return 1
+			}
+			return 0
+		})
+		*b = parts[0]
+		mu.Lock()
+		defer mu.Unlock()
+		for i, part := range parts[1].Split(func(rel string) int { return groupOf(rc, rel) }) {
+			groups[i].batch.Merge(part)
+			if !storm.active() {
+				arm(groups[i])
+			}
+		}
+		return parts[1]
 	}
 
-	startTimers := func() {
-		if rc.BatchWindow > 0 && batchTimer == nil {
-			batchTimer = time.AfterFunc(rc.BatchWindow, func() { flush("batch") })
+	// stopTimers disarms every group's timers; callers hold mu.
+	stopTimers := func() {
+		for _, g := range groups {
+			g.stopTimers()
 		}
-		if rc.IdleWindow > 0 {
-			if idleTimer != nil {
-				idleTimer.Stop()
+	}
+
+	// endStorm runs once a storm has been quiet for rc.StormQuiet.
+	endStorm := func() {
+		mu.Lock()
+		if !storm.active() || time.Since(storm.last) < firstDur(rc.StormQuiet, defaultStormQuiet) {
+			mu.Unlock() // rearmed by a batch while firing
+			return
+		}
+		s := storm
+		storm = stormState{}
+		mu.Unlock()
+		log.Printf("[INFO] event storm over (%s): %d events in %s", rc.Path, s.events, time.Since(s.start).Round(time.Second))
+		flushAll("after-storm")
+	}
+
+	// stormy tracks bulk operations; during one no timer is armed and the
+	// quiet timer restarts with every batch. Callers hold mu.
+	stormy := func(b watch.Batch) bool {
+		if rc.StormThreshold <= 0 {
+			return false
+		}
+		quiet := firstDur(rc.StormQuiet, defaultStormQuiet)
+		if !storm.active() {
+			rate := eventRate(b)
+			if rate < float64(rc.StormThreshold) {
+				return false
 			}
-			idleTimer = time.AfterFunc(rc.IdleWindow, func() { flush("idle") })
+			log.Printf("[INFO] event storm (%s): %.0f events/s, pausing autosaves until quiet", rc.Path, rate)
+			stopTimers()
+			storm.start = b.First
+			storm.quiet = time.AfterFunc(quiet, endStorm)
 		}
+		storm.events += b.Events
+		storm.last = time.Now()
+		storm.quiet.Reset(quiet)
+		return true
 	}
 
+	// catchUp commits what changed while nothing was watching: before the
+	// worker started, or while the machine slept
+	catchUp := func(reason string) {
+		b, err := watch.Dirty(rc)
+		if err != nil {
+			log.Printf("[WARN] %s check (%s): %v", reason, rc.Path, err)
+			return
+		}
+		if b.Empty() {
+			return
+		}
+		commitAll := func() {
+			log.Printf("[INFO] found %d uncommitted change(s) (%s): %s", len(b.Paths), rc.Path, reason)
+			mu.Lock()
+			rest.batch.Merge(b)
+			mu.Unlock()
+			flushAll(reason)
+		}
+		switch rc.StartupCommit {
+		case "false":
+			return
+		case "prompt":
+			// asked off the event loop, which keeps batching meanwhile
+			go func() {
+				if confirm(ctx, fmt.Sprintf("%s has %d uncommitted change(s) (%s). Autosave them now?", rc.Path, len(b.Paths), reason)) {
+					commitAll()
+				} else {
+					log.Printf("[INFO] left %d uncommitted change(s) alone (%s): %s", len(b.Paths), rc.Path, reason)
+				}
+			}()
+			return
+		}
+		commitAll()
+	}
+	catchUp("startup")
+	lastTick := time.Now()
+
 	// Event loop
 	for {
 		select {
-		case f, ok := <-changes:
+		case <-ctx.Done():
+			// waits for an in-flight git operation, then commits what's pending
+			reason := "shutdown"
+			if errors.Is(context.Cause(ctx), errReload) {
+				reason = "reload"
+			}
+			log.Printf("[INFO] stopping worker (%s): %s", rc.Path, reason)
+			flushAll(reason)
+			return
+		case b, ok := <-changes:
 			if !ok {
-				if stop != nil {
-					stop()
+				// the watcher heals itself and only closes once stopped
+				log.Printf("[WARN] watcher closed (%s); continuing with interval commits only", rc.Path)
+				changes = nil
+				continue
+			}
+			mu.Lock()
+			inStorm := stormy(b)
+			parts := b.Split(func(rel string) int { return groupOf(rc, rel) })
+			if len(parts) == 0 {
+				rest.batch.Merge(b) // only suppressed events
+			}
+			var full []*group
+			for i, part := range parts {
+				g := groups[i]
+				g.batch.Merge(part)
+				if inStorm {
+					continue
 				}
-				if ticker != nil {
-					ticker.Stop()
+				arm(g)
+				if !g.full && overLimit(g.rc, g.batch) != "" {
+					// a long burst is cut into commits of bounded size
+					g.full = true
+					full = append(full, g)
 				}
-				flush("shutdown")
-				return
 			}
+			mu.Unlock()
+			for _, g := range full {
+				go flush("size", g.rc, g)
+			}
+			if b.Rescan && !inStorm {
+				// events were lost; commit what git sees without waiting
+				go flushAll("rescan")
+			}
+		case <-tick(ticker):
 			mu.Lock()
-			set[f] = struct{}{}
+			inStorm := storm.active()
 			mu.Unlock()
-			startTimers()
-		case <-func() <-chan time.Time {
-			if ticker != nil {
-				return ticker.C
+			if !inStorm {
+				flushAll("interval")
 			}
-			return nil
-		}():
-			flush("interval")
+		case <-tick(backupTicker):
+			// bundling only reads refs, so it runs beside the event loop and
+			// the autosaves; while one is still running the tick is skipped
+			if !backupMu.TryLock() {
+				continue
+			}
+			backups.Add(1)
+			go func() {
+				defer backups.Done()
+				defer backupMu.Unlock()
+				file, err := backup.Run(rc)
+				if err != nil {
+					log.Printf("[ERROR] backup (%s): %v", rc.Path, err)
+				} else if file != "" {
+					log.Printf("[OK] backup (%s): %s", rc.Path, file)
+				}
+			}()
+		case <-headTicker.C:
+			now := time.Now()
+			if slept(lastTick, now) {
+				log.Printf("[INFO] woke from sleep (%s)", rc.Path)
+				catchUp("wake")
+			}
+			lastTick = now
+			gitMu.Lock()
+			checkHead()
+			gitMu.Unlock()
+		}
+	}
+}
+
+var (
+	locksMu   sync.Mutex
+	repoLocks = map[string]*sync.Mutex{}
+)
+
+// repoLock returns the mutex serializing git operations on the repository
+// at gitDir.
+func repoLock(gitDir string) *sync.Mutex {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if repoLocks[gitDir] == nil {
+		repoLocks[gitDir] = &sync.Mutex{}
+	}
+	return repoLocks[gitDir]
+}
+
+// maxDefer bounds how long a file still being written keeps its changes out
+// of autosaves; tests shorten it.
+var maxDefer = 2 * time.Minute
+
+// defaultStormQuiet ends a storm when storm_quiet is unset.
+const defaultStormQuiet = 3 * time.Second
+
+// stormState is a burst of events too dense to be anything but a bulk
+// operation such as a checkout, npm install or rm -rf.
+type stormState struct {
+	start  time.Time
+	last   time.Time // when the latest batch arrived
+	events int
+	quiet  *time.Timer
+}
+
+func (s stormState) active() bool { return s.quiet != nil }
+
+// eventRate is a batch's events per second, over at least one second so a
+// short burst isn't inflated.
+func eventRate(b watch.Batch) float64 {
+	span := b.Last.Sub(b.First)
+	if span < time.Second {
+		span = time.Second
+	}
+	return float64(b.Events) / span.Seconds()
+}
+
+func firstDur(a ...time.Duration) time.Duration {
+	for _, d := range a {
+		if d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// noteFor describes batch b for an autosave note.
+func noteFor(reason string, b watch.Batch) gitops.Note {
+	files := b.Sorted()
+	return gitops.Note{Reason: reason, Paths: files, Ops: ops(b), Renames: b.Renames, BatchStart: b.First, BatchEnd: time.Now(), Events: b.Events, Suppressed: b.Suppressed}
+}
+
+// ops flattens a batch's per-path ops for the note.
+func ops(b watch.Batch) map[string]string {
+	if len(b.Paths) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(b.Paths))
+	for p, op := range b.Paths {
+		m[p] = op.String()
+	}
+	return m
+}
+
+// commit autosaves the working tree according to the branch, protection and
+// detached-HEAD policies.
+func commit(rc config.RepoConfig, files []string, note gitops.Note) {
+	h := gitops.ReadHead(rc.Path)
+	tgt := gitops.TargetFor(rc, h)
+	note.Redirect = tgt.Why
+	if tgt.Skip {
+		log.Printf("[INFO] skipped autosave (%s): %s", rc.Path, tgt.Why)
+		return
+	}
+
+	var (
+		msg string
+		err error
+	)
+	if tgt.Ref == "" {
+		msg, err = gitops.CommitAndMaybePush(rc, files, note)
+	} else if gitops.HasChanges(rc.Path) {
+		msg, err = gitops.CommitToRef(rc, tgt.Ref, h.Commit, nil, files, note)
+	}
+	if err = noteFailed(rc, err); err != nil {
+		log.Printf("[ERROR] commit (%s): %v", rc.Path, err)
+		return
+	}
+	if msg != "" && tgt.Ref != "" {
+		log.Printf("[OK] committed (%s) to %s (%s): %s", rc.Path, tgt.Ref, tgt.Why, msg)
+	} else if msg != "" {
+		log.Printf("[OK] committed (%s): %s", rc.Path, msg)
+	}
+}
+
+// noteFailed logs a note that couldn't be written after its commit went in
+// and clears it; any other error is returned as is.
+func noteFailed(rc config.RepoConfig, err error) error {
+	var ne *gitops.NoteError
+	if !errors.As(err, &ne) {
+		return err
+	}
+	log.Printf("[WARN] note (%s): committed, but %v", rc.Path, ne)
+	return nil
+}
+
+// attribute commits changes batched before a checkout to the branch they were
+// made on and returns the paths committed. Paths the checkout itself rewrote
+// are dropped.
+func attribute(rc config.RepoConfig, old, cur gitops.Head, files []string, note gitops.Note) []string {
+	oldCommit := old.Commit
+	if !old.Detached() {
+		oldCommit = firstNonEmpty(gitops.ResolveRef(rc.Path, "refs/heads/"+old.Branch), old.Commit)
+	}
+	changed, err := gitops.ChangedBetween(rc.Path, oldCommit, cur.Commit)
+	if err != nil {
+		log.Printf("[WARN] branch switch (%s): %v", rc.Path, err)
+	}
+	byCheckout := make(map[string]bool, len(changed))
+	for _, p := range changed {
+		byCheckout[p] = true
+	}
+	var keep []string
+	for _, f := range files {
+		if !byCheckout[f] {
+			keep = append(keep, f)
+		}
+	}
+	if n := len(files) - len(keep); n > 0 {
+		log.Printf("[INFO] discarded %d pending path(s) rewritten by checkout (%s)", n, rc.Path)
+	}
+	if len(keep) == 0 {
+		return nil
+	}
+	tgt := gitops.TargetFor(rc, old)
+	if tgt.Skip {
+		log.Printf("[INFO] dropped pending changes for %s (%s): %s", describeHead(old), rc.Path, tgt.Why)
+		return nil
+	}
+	if tgt.Ref == "" && old.Detached() {
+		log.Printf("[WARN] %d pending path(s) from detached HEAD left uncommitted (%s)", len(keep), rc.Path)
+		return nil
+	}
+	ref := firstNonEmpty(tgt.Ref, "refs/heads/"+old.Branch)
+	if tgt.Why != "" {
+		log.Printf("[INFO] redirecting pending changes for %s to %s (%s): %s", describeHead(old), ref, rc.Path, tgt.Why)
+	}
+	note.Paths = keep
+	note.Redirect = tgt.Why
+	msg, err := gitops.CommitToRef(rc, ref, oldCommit, keep, keep, note)
+	if err = noteFailed(rc, err); err != nil {
+		log.Printf("[ERROR] commit to %s (%s): %v", ref, rc.Path, err)
+		return nil
+	}
+	if msg != "" {
+		log.Printf("[OK] committed pending changes (%s) to %s: %s", rc.Path, ref, msg)
+	}
+	return keep
+}
+
+// tick returns t's channel, or nil (blocks forever) when t is nil.
+func tick(t *time.Ticker) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C
+}
+
+func describeHead(h gitops.Head) string {
+	if h.Detached() {
+		return fmt.Sprintf("detached %.8s", h.Commit)
+	}
+	return h.Branch
+}
+
+func firstNonEmpty(a ...string) string {
+	for _, s := range a {
+		if s != "" {
+			return s
 		}
 	}
+	return ""
 }
@@ -0,0 +1,274 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+	"github.com/whrit/autoGit/internal/theme"
+)
+
+// newRepo returns a repository on branch work with one commit.
+func newRepo(t *testing.T) string {
+	t.Helper()
+	root := testutil.NewRepo(t)
+	testutil.Commit(t, root, "README", "hi\n", "init")
+	return root
+}
+
+// testRepo is a watching config with short windows for rc.Path = root.
+func testRepo(root string) config.RepoConfig {
+	rc := config.DefaultRepo(root)
+	rc.DebounceMS = 20
+	rc.BatchWindow = 0
+	rc.IdleWindow = 300 * time.Millisecond
+	rc.WriteProbe = 0
+	rc.StormThreshold = 0
+	rc.ProtectedBranches = []string{}
+	return rc
+}
+
+// start runs a worker for rc until the test ends or the returned stop is
+// called, which waits for its final flush.
+func start(t *testing.T, rc config.RepoConfig) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runRepo(ctx, rc, theme.Theme{})
+	}()
+	stop = func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("worker did not stop")
+		}
+	}
+	t.Cleanup(func() { cancel(); <-done })
+	time.Sleep(300 * time.Millisecond) // let the watcher settle
+	return stop
+}
+
+// waitFor polls cond until it holds or d passes.
+func waitFor(t *testing.T, d time.Duration, what string, cond func() bool) {
+	t.Helper()
+	for end := time.Now().Add(d); time.Now().Before(end); time.Sleep(50 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestShutdownFlushesPending(t *testing.T) {
+	root := newRepo(t)
+	base := testutil.Git(t, root, "rev-parse", "HEAD")
+	rc := testRepo(root)
+	rc.IdleWindow = time.Hour
+	stop := start(t, rc)
+
+	testutil.Write(t, root, "a.txt", "pending\n")
+	time.Sleep(200 * time.Millisecond) // past the debounce, far from the idle window
+	if got := testutil.Git(t, root, "rev-parse", "HEAD"); got != base {
+		t.Fatal("committed before shutdown")
+	}
+	stop()
+	if got := testutil.Git(t, root, "show", "--format=", "--name-only", "HEAD"); got != "a.txt" {
+		t.Errorf("shutdown commit has %q, want a.txt", got)
+	}
+	if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", "HEAD"); !strings.Contains(out, `"reason":"shutdown"`) {
+		t.Errorf("note = %s", out)
+	}
+}
+
+func TestRunReturnsAfterShutdown(t *testing.T) {
+	root := newRepo(t)
+	cfg := config.Config{ShutdownTimeout: 5 * time.Second, Repos: []config.RepoConfig{testRepo(root)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, cfg, theme.Theme{})
+	}()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
+
+func TestCheckoutDoesNotRecommitAttributedPaths(t *testing.T) {
+	root := newRepo(t)
+	base := testutil.Git(t, root, "rev-parse", "HEAD")
+	stop := start(t, testRepo(root))
+
+	// an edit batched on work, then a checkout before it is committed
+	testutil.Write(t, root, "a.txt", "on work\n")
+	time.Sleep(150 * time.Millisecond)
+	testutil.Git(t, root, "checkout", "-q", "-b", "feature")
+	waitFor(t, 5*time.Second, "commit on work", func() bool {
+		return testutil.Git(t, root, "rev-parse", "work") != base
+	})
+	if got := testutil.Git(t, root, "show", "--format=", "--name-only", "work"); got != "a.txt" {
+		t.Fatalf("work got %q, want a.txt", got)
+	}
+
+	// the next autosave on feature leaves a.txt to work
+	testutil.Write(t, root, "b.txt", "on feature\n")
+	waitFor(t, 5*time.Second, "commit on feature", func() bool {
+		return testutil.Git(t, root, "rev-parse", "feature") != base
+	})
+	if got := testutil.Git(t, root, "show", "--format=", "--name-only", "feature"); got != "b.txt" {
+		t.Errorf("feature got %q, want b.txt", got)
+	}
+
+	// until a.txt is edited again
+	testutil.Write(t, root, "a.txt", "on feature\n")
+	time.Sleep(150 * time.Millisecond)
+	stop()
+	if got := testutil.Git(t, root, "show", "--format=", "--name-only", "feature"); got != "a.txt" {
+		t.Errorf("feature got %q after editing a.txt, want a.txt", got)
+	}
+}
+
+func TestStormCommitsOnceAfterQuiet(t *testing.T) {
+	root := newRepo(t)
+	base := testutil.Git(t, root, "rev-parse", "HEAD")
+	rc := testRepo(root)
+	rc.StormThreshold = 50
+	rc.StormQuiet = 500 * time.Millisecond
+	start(t, rc)
+
+	// an edit arms the idle timer just before a bulk operation starts: a
+	// steady stream of writes for well over the idle window
+	testutil.Write(t, root, "a.txt", "a\n")
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 300; i++ {
+		testutil.Write(t, root, fmt.Sprintf("gen/f%03d.txt", i), "x\n")
+		time.Sleep(3 * time.Millisecond)
+	}
+	if head := testutil.Git(t, root, "rev-parse", "HEAD"); head != base {
+		t.Fatalf("committed during the storm: %s", testutil.Git(t, root, "log", "--format=%B", "-1"))
+	}
+
+	// quiet: nothing until storm_quiet has passed, then one commit
+	time.Sleep(rc.StormQuiet / 2)
+	if head := testutil.Git(t, root, "rev-parse", "HEAD"); head != base {
+		t.Fatal("committed before the storm went quiet")
+	}
+	waitFor(t, 5*time.Second, "after-storm commit", func() bool {
+		return testutil.Git(t, root, "rev-parse", "HEAD") != base
+	})
+	time.Sleep(500 * time.Millisecond)
+	if n := testutil.Git(t, root, "rev-list", "--count", base+"..HEAD"); n != "1" {
+		t.Errorf("%s commits after the storm, want 1", n)
+	}
+	if msg := testutil.Git(t, root, "log", "--format=%B", "-1"); !strings.Contains(msg, "Autosave-Reason: after-storm") {
+		t.Errorf("message %q, want reason after-storm", msg)
+	}
+	if n := len(strings.Fields(testutil.Git(t, root, "show", "--format=", "--name-only", "HEAD"))); n != 301 {
+		t.Errorf("after-storm commit has %d files, want 301", n)
+	}
+}
+
+func TestBusyFileIsDeferredThenCommitted(t *testing.T) {
+	root := newRepo(t)
+	base := testutil.Git(t, root, "rev-parse", "HEAD")
+	old := maxDefer
+	t.Cleanup(func() { maxDefer = old }) // after the worker stops
+	maxDefer = 1500 * time.Millisecond
+	rc := testRepo(root)
+	rc.WriteProbe = 100 * time.Millisecond
+	rc.BatchWindow = 300 * time.Millisecond
+	rc.IdleWindow = 0 // never quiet while big.bin grows
+	start(t, rc)
+
+	// big.bin grows without pause, as during a long copy
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f, err := os.Create(filepath.Join(root, "big.bin"))
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		for end := time.Now().Add(3 * time.Second); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+			f.Write([]byte("x"))
+		}
+	}()
+	t.Cleanup(func() { <-done })
+	testutil.Write(t, root, "a.txt", "a\n")
+
+	waitFor(t, 5*time.Second, "commit of a.txt", func() bool {
+		return testutil.Git(t, root, "rev-parse", "HEAD") != base
+	})
+	if got := testutil.Git(t, root, "show", "--format=", "--name-only", "HEAD"); got != "a.txt" {
+		t.Fatalf("first commit has %q, want a.txt alone", got)
+	}
+	// held back, then committed once maxDefer has passed, still growing
+	first := testutil.Git(t, root, "rev-parse", "HEAD")
+	waitFor(t, 5*time.Second, "commit of big.bin", func() bool {
+		return testutil.Git(t, root, "rev-parse", "HEAD") != first
+	})
+	if got := testutil.Git(t, root, "show", "--format=", "--name-only", "HEAD"); got != "big.bin" {
+		t.Errorf("second commit has %q, want big.bin", got)
+	}
+	select {
+	case <-done:
+		t.Error("big.bin was only committed once writing stopped")
+	default:
+	}
+}
+
+func TestSizeFlushCutsLongBatch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		set     func(rc *config.RepoConfig)
+		trigger string
+	}{
+		{"files", func(rc *config.RepoConfig) { rc.MaxBatchFiles = 3 }, "3 files, max_batch_files 3"},
+		{"bytes", func(rc *config.RepoConfig) { rc.MaxBatchBytes = 15 }, "15 bytes, max_batch_bytes 15"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := newRepo(t)
+			base := testutil.Git(t, root, "rev-parse", "HEAD")
+			rc := testRepo(root)
+			rc.IdleWindow = time.Minute // only the size limit commits
+			tc.set(&rc)
+			stop := start(t, rc)
+
+			for _, f := range []string{"a.txt", "b.txt", "c.txt"} {
+				testutil.Write(t, root, f, "01234")
+			}
+			waitFor(t, 5*time.Second, "size commit", func() bool {
+				return testutil.Git(t, root, "rev-parse", "HEAD") != base
+			})
+			msg := testutil.Git(t, root, "log", "--format=%B", "-1")
+			if !strings.Contains(msg, "Autosave-Reason: size") || !strings.Contains(msg, "Autosave-Trigger: size ("+tc.trigger+")") {
+				t.Errorf("message %q, want a size commit naming the limit", msg)
+			}
+
+			// below the limit nothing is committed until shutdown
+			sized := testutil.Git(t, root, "rev-parse", "HEAD")
+			testutil.Write(t, root, "d.txt", "d")
+			time.Sleep(300 * time.Millisecond)
+			if testutil.Git(t, root, "rev-parse", "HEAD") != sized {
+				t.Error("committed below the limit")
+			}
+			stop()
+			if got := testutil.Git(t, root, "show", "--format=", "--name-only", "HEAD"); got != "d.txt" {
+				t.Errorf("shutdown commit has %q, want d.txt", got)
+			}
+		})
+	}
+}
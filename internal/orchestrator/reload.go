@@ -0,0 +1,172 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/logs"
+	"github.com/whrit/autoGit/internal/theme"
+)
+
+// errReload cancels a worker whose entry was removed or changed; it then
+// flushes with reason "reload" rather than "shutdown".
+var errReload = errors.New("config reloaded")
+
+// reloadSettle lets an editor finish writing the config before it is read.
+const reloadSettle = 500 * time.Millisecond
+
+// worker is one running runRepo.
+type worker struct {
+	rc     config.RepoConfig
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// supervisor keeps one worker per repo entry in step with the config.
+type supervisor struct {
+	ctx     context.Context
+	t       theme.Theme
+	wg      sync.WaitGroup
+	workers map[string]*worker
+}
+
+// apply diffs repos against the running workers: workers for removed
+// entries stop, changed ones restart with their pending batch flushed first,
+// and new ones start. Unchanged workers keep running untouched.
+func (s *supervisor) apply(repos []config.RepoConfig) (started, restarted, stopped int) {
+	want := map[string]config.RepoConfig{}
+	for _, rc := range adoptNested(repos) {
+		k := repoKey(rc)
+		for n := 2; ; n++ { // identical entries are kept apart
+			if _, dup := want[k]; !dup {
+				break
+			}
+			k = fmt.Sprintf("%s#%d", repoKey(rc), n)
+		}
+		want[k] = rc
+	}
+	for k, w := range s.workers {
+		rc, keep := want[k]
+		if keep && reflect.DeepEqual(rc, w.rc) {
+			continue
+		}
+		w.cancel(errReload)
+		<-w.done
+		delete(s.workers, k)
+		if keep {
+			restarted++
+			log.Printf("[INFO] restarted worker for %s with changed settings", rc.Path)
+		} else {
+			stopped++
+			log.Printf("[INFO] stopped watching %s", w.rc.Path)
+		}
+	}
+	for k, rc := range want {
+		if _, running := s.workers[k]; running {
+			continue
+		}
+		ctx, cancel := context.WithCancelCause(s.ctx)
+		w := &worker{rc: rc, cancel: cancel, done: make(chan struct{})}
+		s.workers[k] = w
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer close(w.done)
+			runRepo(ctx, rc, s.t)
+		}()
+		started++
+	}
+	return started - restarted, restarted, stopped
+}
+
+// repoKey identifies an entry across reloads: its repo and its includes.
+func repoKey(rc config.RepoConfig) string {
+	return filepath.Clean(rc.Path) + "\x00" + strings.Join(rc.Includes, "\x00")
+}
+
+// reload reads and validates the config file and applies it. An unreadable
+// or invalid config is rejected and the running workers are left alone.
+func (s *supervisor) reload(cfg *config.Config) {
+	next, found, err := config.Load()
+	if err == nil && !found {
+		err = fmt.Errorf("%s is missing", config.Path())
+	}
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		log.Printf("[ERROR] config reload rejected, keeping the running config: %v", err)
+		return
+	}
+	logs.SetDebug(next.Debug)
+	started, restarted, stopped := s.apply(next.Repos)
+	*cfg = next
+	log.Printf("[INFO] config reloaded: %d started, %d restarted, %d stopped", started, restarted, stopped)
+}
+
+// reloads signals when the config file at path changes or the process gets
+// SIGHUP. The directory is watched since editors often replace the file, and
+// a burst of writes counts once.
+func reloads(ctx context.Context, path string) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var events <-chan fsnotify.Event
+	w, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = w.Add(filepath.Dir(path)); err != nil {
+			w.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("[WARN] not watching %s for changes: %v; send SIGHUP to reload", path, err)
+	} else {
+		events = w.Events
+	}
+	notify := func() {
+		select {
+		case out <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		defer signal.Stop(hup)
+		if events != nil {
+			defer w.Close()
+		}
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Printf("[INFO] SIGHUP: reloading config")
+				notify()
+			case ev, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				if filepath.Clean(ev.Name) == filepath.Clean(path) && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					settle = time.After(reloadSettle)
+				}
+			case <-settle:
+				settle = nil
+				notify()
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,55 @@
+package orchestrator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+	"github.com/whrit/autoGit/internal/theme"
+)
+
+func TestApplyDiffsWorkers(t *testing.T) {
+	root := newRepo(t)
+	base := testutil.Git(t, root, "rev-parse", "HEAD")
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &supervisor{ctx: ctx, t: theme.Theme{}, workers: map[string]*worker{}}
+	t.Cleanup(func() { cancel(); s.wg.Wait() })
+	check := func(repos []config.RepoConfig, started, restarted, stopped int) {
+		t.Helper()
+		a, b, c := s.apply(repos)
+		if a != started || b != restarted || c != stopped {
+			t.Errorf("apply = %d started, %d restarted, %d stopped; want %d, %d, %d", a, b, c, started, restarted, stopped)
+		}
+	}
+
+	rc := testRepo(root)
+	rc.IdleWindow = time.Minute
+	check([]config.RepoConfig{rc}, 1, 0, 0)
+	check([]config.RepoConfig{rc}, 0, 0, 0)
+	time.Sleep(300 * time.Millisecond) // let the watcher settle
+
+	// a changed entry restarts, committing what the old worker had pending
+	testutil.Write(t, root, "a.txt", "a")
+	time.Sleep(150 * time.Millisecond)
+	changed := rc
+	changed.IdleWindow = 2 * time.Minute
+	check([]config.RepoConfig{changed}, 0, 1, 0)
+	if testutil.Git(t, root, "rev-parse", "HEAD") == base {
+		t.Fatal("pending change not committed before the restart")
+	}
+	if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", "HEAD"); !strings.Contains(out, `"reason":"reload"`) {
+		t.Errorf("note = %s, want reason reload", out)
+	}
+
+	// another entry for the same repo with other includes runs beside it
+	scoped := changed
+	scoped.Includes = []string{"src"}
+	check([]config.RepoConfig{changed, scoped}, 1, 0, 0)
+	check(nil, 0, 0, 2)
+	if len(s.workers) != 0 {
+		t.Errorf("%d workers left", len(s.workers))
+	}
+}
@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/watch"
+)
+
+// group is the pending batch of one path rule, or of the paths no rule
+// claims. Each group arms its own timers and commits its own paths.
+type group struct {
+	rc     config.RepoConfig // with the rule's overrides and scope
+	settle time.Duration     // debounce on top of the watcher's
+
+	batch       watch.Batch
+	batchTimer  *time.Timer
+	idleTimer   *time.Timer
+	settleTimer *time.Timer
+	full        bool // a size flush is on its way
+}
+
+// newGroups returns a group per path rule followed by the default group.
+// The watcher runs with the shortest debounce of them all, so the others wait
+// out the difference themselves.
+func newGroups(rc config.RepoConfig) (groups []*group, debounceMS int) {
+	debounceMS = rc.DebounceMS
+	for i := range rc.PathRules {
+		groups = append(groups, &group{rc: rc.Rule(i)})
+		debounceMS = min(debounceMS, groups[i].rc.DebounceMS)
+	}
+	groups = append(groups, &group{rc: rc})
+	for _, g := range groups {
+		g.settle = time.Duration(g.rc.DebounceMS-debounceMS) * time.Millisecond
+	}
+	return groups, debounceMS
+}
+
+// groupOf returns the index of the first rule matching rel, or of the
+// default group.
+func groupOf(rc config.RepoConfig, rel string) int {
+	for i, r := range rc.PathRules {
+		if watch.Matches(r.Match, rel) {
+			return i
+		}
+	}
+	return len(rc.PathRules)
+}
+
+// stopTimers disarms g's timers.
+func (g *group) stopTimers() {
+	for _, t := range []**time.Timer{&g.batchTimer, &g.idleTimer, &g.settleTimer} {
+		if *t != nil {
+			(*t).Stop()
+			*t = nil
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+)
+
+func TestGroups(t *testing.T) {
+	ms := func(n int) *int { return &n }
+	idle := 30 * time.Second
+	rc := config.DefaultRepo(t.TempDir())
+	rc.DebounceMS = 1000
+	rc.Includes = []string{"src", "docs"}
+	rc.PathRules = []config.PathRule{
+		{Match: []string{"docs/**"}, DebounceMS: ms(4000), IdleWindow: &idle, Msg: "docs: {files}"},
+		{Match: []string{"*.md"}, DebounceMS: ms(200)},
+	}
+	groups, debounceMS := newGroups(rc)
+	if len(groups) != 3 || debounceMS != 200 {
+		t.Fatalf("%d groups, watcher debounce %dms; want 3, 200ms", len(groups), debounceMS)
+	}
+	docs, md, rest := groups[0].rc, groups[1].rc, groups[2].rc
+	if docs.IdleWindow != idle || docs.BatchWindow != rc.BatchWindow || docs.Msg != "docs: {files}" || len(docs.PathRules) != 0 {
+		t.Errorf("docs rule = %+v", docs)
+	}
+	if len(md.PathRules) != 1 || len(md.Includes) != 2 || len(md.RuleMatch) != 1 {
+		t.Errorf("*.md rule: includes %v, match %v, earlier rules %d", md.Includes, md.RuleMatch, len(md.PathRules))
+	}
+	if len(rest.PathRules) != 2 || rest.RuleMatch != nil {
+		t.Errorf("default group = %+v", rest)
+	}
+	for i, want := range []time.Duration{3800 * time.Millisecond, 0, 800 * time.Millisecond} {
+		if groups[i].settle != want {
+			t.Errorf("group %d settles %s, want %s", i, groups[i].settle, want)
+		}
+	}
+
+	for rel, want := range map[string]int{
+		"docs/a.md":     0, // first match wins
+		"docs/img.png":  0,
+		"src/README.md": 1,
+		"src/main.go":   2,
+		"main.go":       2,
+	} {
+		if got := groupOf(rc, rel); got != want {
+			t.Errorf("groupOf(%s) = %d, want %d", rel, got, want)
+		}
+	}
+}
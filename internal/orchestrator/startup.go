@@ -0,0 +1,105 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+)
+
+// wakeJump is how far the wall clock may pull ahead of the monotonic clock,
+// which stops while the machine sleeps, before a wake-up is assumed.
+const wakeJump = time.Minute
+
+// slept reports whether the machine was asleep between two readings of
+// time.Now. Tests replace it to simulate a wake-up.
+var slept = func(last, now time.Time) bool {
+	return jumped(now.Round(0).Sub(last.Round(0)), now.Sub(last))
+}
+
+// jumped reports whether wall clock time ran ahead of monotonic time by more
+// than wakeJump.
+func jumped(wall, mono time.Duration) bool {
+	return wall-mono > wakeJump
+}
+
+// promptMu keeps workers from asking at the same time.
+var promptMu sync.Mutex
+
+// promptTimeout is how long confirm waits for an answer.
+var promptTimeout = 2 * time.Minute
+
+// isTerminal and answers are where confirm looks for a user; tests replace
+// them.
+var (
+	isTerminal = config.IsTerminal
+	answers    = lines
+)
+
+var (
+	stdinOnce  sync.Once
+	stdinLines chan string
+)
+
+// lines returns the terminal's input line by line. A single goroutine reads
+// config.Stdin for every prompt, so a prompt that timed out doesn't leave a
+// reader behind to swallow the next answer.
+func lines() <-chan string {
+	stdinOnce.Do(func() {
+		stdinLines = make(chan string)
+		go func() {
+			defer close(stdinLines)
+			for {
+				line, err := config.Stdin.ReadString('\n')
+				if line != "" {
+					stdinLines <- line
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+	return stdinLines
+}
+
+// confirm asks a yes/no question on the terminal. Without one (e.g. under a
+// LaunchAgent), without an answer within promptTimeout, or once ctx is done,
+// the answer is no.
+func confirm(ctx context.Context, question string) bool {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if !isTerminal() {
+		return false
+	}
+	in := answers()
+	// whatever was typed before the question isn't an answer to it
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-in:
+			if !ok {
+				return false
+			}
+		default:
+			drained = true
+		}
+	}
+	fmt.Printf("? %s (y/n): ", question)
+	select {
+	case line := <-in:
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		}
+	case <-time.After(promptTimeout):
+		fmt.Println()
+		log.Printf("[INFO] no answer within %s; taking that as no", promptTimeout)
+	case <-ctx.Done():
+		fmt.Println()
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package orchestrator
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestSlept(t *testing.T) {
+	cases := []struct {
+		wall, mono time.Duration
+		want       bool
+	}{
+		{time.Minute, time.Minute, false},
+		{time.Hour, time.Hour, false},
+		{wakeJump, 0, false},
+		{wakeJump + time.Second, 0, true},
+		{8 * time.Hour, 30 * time.Second, true},
+		{0, time.Hour, false}, // wall clock set back
+	}
+	for _, tc := range cases {
+		if got := jumped(tc.wall, tc.mono); got != tc.want {
+			t.Errorf("jumped(%s, %s) = %v, want %v", tc.wall, tc.mono, got, tc.want)
+		}
+	}
+
+	// readings that share a clock never look like a wake-up
+	now := time.Now()
+	if slept(now, now.Add(time.Hour)) || slept(now.Round(0), now.Add(time.Hour).Round(0)) {
+		t.Error("an hour on both clocks counted as sleep")
+	}
+}
+
+// dirtyRepo returns a repository with a.txt changed before any worker runs.
+func dirtyRepo(t *testing.T) (root, base string) {
+	t.Helper()
+	root = newRepo(t)
+	base = testutil.Git(t, root, "rev-parse", "HEAD")
+	testutil.Write(t, root, "a.txt", "while away\n")
+	return root, base
+}
+
+// stays fails the test if HEAD moves from base within d.
+func stays(t *testing.T, root, base string, d time.Duration, what string) {
+	t.Helper()
+	for end := time.Now().Add(d); time.Now().Before(end); time.Sleep(50 * time.Millisecond) {
+		if testutil.Git(t, root, "rev-parse", "HEAD") != base {
+			t.Fatalf("committed %s", what)
+		}
+	}
+}
+
+func TestStartupCommit(t *testing.T) {
+	for _, mode := range []string{"true", "false", "prompt"} {
+		t.Run(mode, func(t *testing.T) {
+			root, base := dirtyRepo(t)
+			rc := testRepo(root)
+			rc.StartupCommit = mode
+			stop := start(t, rc)
+
+			if mode != "true" {
+				// prompt without a terminal is a no
+				stays(t, root, base, 500*time.Millisecond, "changes found on start")
+				stop()
+				if testutil.Git(t, root, "rev-parse", "HEAD") != base {
+					t.Error("shutdown committed the changes found on start")
+				}
+				return
+			}
+			waitFor(t, 5*time.Second, "startup commit", func() bool {
+				return testutil.Git(t, root, "rev-parse", "HEAD") != base
+			})
+			if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", "HEAD"); !strings.Contains(out, `"reason":"startup"`) {
+				t.Errorf("note = %s", out)
+			}
+		})
+	}
+}
+
+// fakePrompt makes confirm find a terminal whose lines come from the
+// returned channel; asked is closed once confirm starts listening.
+func fakePrompt(t *testing.T) (in chan string, asked chan struct{}) {
+	t.Helper()
+	oldTerm, oldAnswers, oldTimeout := isTerminal, answers, promptTimeout
+	t.Cleanup(func() { isTerminal, answers, promptTimeout = oldTerm, oldAnswers, oldTimeout })
+	in, asked = make(chan string, 1), make(chan struct{})
+	var once sync.Once
+	isTerminal = func() bool { return true }
+	answers = func() <-chan string {
+		once.Do(func() { close(asked) })
+		return in
+	}
+	return in, asked
+}
+
+// waitAsked waits for the question to be asked and lets confirm get past
+// dropping stale input.
+func waitAsked(t *testing.T, asked chan struct{}) {
+	t.Helper()
+	select {
+	case <-asked:
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("never asked")
+	}
+}
+
+func TestStartupPromptYes(t *testing.T) {
+	in, asked := fakePrompt(t)
+	root, base := dirtyRepo(t)
+	rc := testRepo(root)
+	rc.StartupCommit = "prompt"
+	start(t, rc)
+
+	waitAsked(t, asked)
+	in <- "y\n"
+	waitFor(t, 5*time.Second, "commit after yes", func() bool {
+		return testutil.Git(t, root, "rev-parse", "HEAD") != base
+	})
+}
+
+func TestStartupPromptTimesOut(t *testing.T) {
+	in, asked := fakePrompt(t)
+	promptTimeout = 200 * time.Millisecond
+	root, base := dirtyRepo(t)
+	rc := testRepo(root)
+	rc.StartupCommit = "prompt"
+	stop := start(t, rc)
+
+	waitAsked(t, asked)
+	stays(t, root, base, 400*time.Millisecond, "without an answer")
+	in <- "y\n" // too late
+	stays(t, root, base, 300*time.Millisecond, "on a late answer")
+	stop()
+	if testutil.Git(t, root, "rev-parse", "HEAD") != base {
+		t.Error("shutdown committed after the prompt timed out")
+	}
+}
+
+func TestStartupPromptEndsAtShutdown(t *testing.T) {
+	in, asked := fakePrompt(t)
+	root, base := dirtyRepo(t)
+	rc := testRepo(root)
+	rc.StartupCommit = "prompt"
+	stop := start(t, rc)
+
+	waitAsked(t, asked)
+	stop()
+	in <- "y\n" // answered once the worker is gone
+	stays(t, root, base, 300*time.Millisecond, "after shutdown")
+}
+
+func TestWakeCommitsUnseenChanges(t *testing.T) {
+	old := slept
+	t.Cleanup(func() { slept = old })
+	var woke atomic.Bool
+	slept = func(last, now time.Time) bool { return woke.Swap(false) }
+
+	root := newRepo(t)
+	base := testutil.Git(t, root, "rev-parse", "HEAD")
+	rc := testRepo(root)
+	rc.Watch = false // changes made while asleep aren't seen
+	start(t, rc)
+
+	testutil.Write(t, root, "a.txt", "while asleep\n")
+	stays(t, root, base, 300*time.Millisecond, "before the wake-up")
+	woke.Store(true)
+	waitFor(t, 5*time.Second, "commit on wake", func() bool {
+		return testutil.Git(t, root, "rev-parse", "HEAD") != base
+	})
+	if out := testutil.Git(t, root, "notes", "--ref=autogit", "show", "HEAD"); !strings.Contains(out, `"reason":"wake"`) {
+		t.Errorf("note = %s", out)
+	}
+}
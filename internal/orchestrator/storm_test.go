@@ -0,0 +1,41 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/watch"
+)
+
+func TestEventRate(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		b    watch.Batch
+		want float64
+	}{
+		{"empty", watch.Batch{}, 0},
+		{"burst counts as a second", watch.Batch{First: at, Last: at.Add(50 * time.Millisecond), Events: 400}, 400},
+		{"spread out", watch.Batch{First: at, Last: at.Add(4 * time.Second), Events: 400}, 100},
+	}
+	for _, tc := range cases {
+		if got := eventRate(tc.b); got != tc.want {
+			t.Errorf("%s: eventRate = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStormActive(t *testing.T) {
+	var s stormState
+	if s.active() {
+		t.Error("zero storm is active")
+	}
+	s.quiet = time.AfterFunc(time.Hour, func() {})
+	defer s.quiet.Stop()
+	if !s.active() {
+		t.Error("storm with a quiet timer isn't active")
+	}
+	if got := firstDur(0, -time.Second, defaultStormQuiet, time.Minute); got != defaultStormQuiet {
+		t.Errorf("firstDur = %s, want %s", got, defaultStormQuiet)
+	}
+}
@@ -0,0 +1,73 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Write renders r as markdown, csv or json.
+func Write(w io.Writer, r Report, format string) error {
+	switch format {
+	case "", "markdown", "md":
+		return writeMarkdown(w, r)
+	case "csv":
+		return writeCSV(w, r)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	default:
+		return fmt.Errorf("unknown report format %q (markdown|csv|json)", format)
+	}
+}
+
+func writeMarkdown(w io.Writer, r Report) error {
+	fmt.Fprintf(w, "# autoGit report\n\n%s → %s, sessions split after %s idle\n",
+		r.Since.Local().Format("2006-01-02 15:04"), r.Until.Local().Format("2006-01-02 15:04"), r.IdleGap)
+	for _, repo := range r.Repos {
+		fmt.Fprintf(w, "\n## %s\n\n", repo.Path)
+		fmt.Fprintf(w, "Active **%s** over %d session(s), %d autosave(s), +%d/-%d lines\n",
+			hm(repo.Active), len(repo.Sessions), repo.Autosaves, repo.Added, repo.Removed)
+		if repo.Suppressed > 0 {
+			fmt.Fprintf(w, "\n%d watcher event(s), %d no-op event(s) suppressed\n", repo.Events, repo.Suppressed)
+		}
+		if len(repo.Days) > 0 {
+			fmt.Fprint(w, "\n| Day | Active | Sessions | Autosaves | Added | Removed |\n|---|---|---|---|---|---|\n")
+			for _, d := range repo.Days {
+				fmt.Fprintf(w, "| %s | %s | %d | %d | %d | %d |\n", d.Date, hm(d.Active), d.Sessions, d.Autosaves, d.Added, d.Removed)
+			}
+		}
+		if len(repo.TopFiles) > 0 {
+			fmt.Fprint(w, "\n| File | Autosaves | Added | Removed |\n|---|---|---|---|\n")
+			for _, f := range repo.TopFiles {
+				fmt.Fprintf(w, "| `%s` | %d | %d | %d |\n", f.Path, f.Autosaves, f.Added, f.Removed)
+			}
+		}
+	}
+	return nil
+}
+
+// writeCSV emits one row per repo and day, which is what billing needs.
+func writeCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"repo", "date", "active_minutes", "sessions", "autosaves", "added", "removed"})
+	for _, repo := range r.Repos {
+		for _, d := range repo.Days {
+			cw.Write([]string{
+				repo.Path, d.Date, strconv.FormatFloat(d.Active.Minutes(), 'f', 1, 64),
+				strconv.Itoa(d.Sessions), strconv.Itoa(d.Autosaves), strconv.Itoa(d.Added), strconv.Itoa(d.Removed),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func hm(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
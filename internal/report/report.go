@@ -0,0 +1,173 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/whrit/autoGit/internal/gitops"
+)
+
+// DefaultIdleGap separates sessions when report_idle_gap is unset.
+const DefaultIdleGap = 30 * time.Minute
+
+// topFiles is how many of the most touched files each repo lists.
+const topFiles = 10
+
+// Report summarizes autosave activity since a point in time.
+type Report struct {
+	Since   time.Time     `json:"since"`
+	Until   time.Time     `json:"until"`
+	IdleGap time.Duration `json:"idle_gap_ns"`
+	Repos   []Repo        `json:"repos"`
+}
+
+// Repo is the activity of one repository.
+type Repo struct {
+	Path      string        `json:"path"`
+	Active    time.Duration `json:"active_ns"`
+	Sessions  []Session     `json:"sessions"`
+	Days      []Day         `json:"days"`
+	Autosaves int           `json:"autosaves"`
+	Added     int           `json:"added"`
+	Removed   int           `json:"removed"`
+	TopFiles  []FileCount   `json:"top_files"`
+	// Events and Suppressed count watcher events behind the autosaves and
+	// the no-op events that were dropped.
+	Events     int `json:"events"`
+	Suppressed int `json:"suppressed_events"`
+}
+
+// Session is a run of autosaves with no gap longer than the idle gap.
+type Session struct {
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Active    time.Duration `json:"active_ns"`
+	Autosaves int           `json:"autosaves"`
+}
+
+// Day aggregates the sessions that started on a local calendar day.
+type Day struct {
+	Date      string        `json:"date"` // 2006-01-02
+	Active    time.Duration `json:"active_ns"`
+	Sessions  int           `json:"sessions"`
+	Autosaves int           `json:"autosaves"`
+	Added     int           `json:"added"`
+	Removed   int           `json:"removed"`
+}
+
+// FileCount is how often a file was touched and its line churn.
+type FileCount struct {
+	Path      string `json:"path"`
+	Autosaves int    `json:"autosaves"`
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+}
+
+// Build reads autosaves and their diffstats from each repo. Autosaves whose
+// notes are missing are found by their Autosave-* trailers; they lack the
+// batch start and event counts, so their sessions start at the commit.
+func Build(repos []string, since time.Time, idleGap time.Duration) (Report, error) {
+	if idleGap <= 0 {
+		idleGap = DefaultIdleGap
+	}
+	r := Report{Since: since, Until: time.Now(), IdleGap: idleGap}
+	for _, p := range repos {
+		list, err := gitops.Autosaves(p, since, 0)
+		if err != nil {
+			return Report{}, err
+		}
+		hashes := make([]string, len(list))
+		for i, a := range list {
+			hashes[i] = a.Hash
+		}
+		stats, err := gitops.DiffStats(p, hashes)
+		if err != nil {
+			return Report{}, err
+		}
+		r.Repos = append(r.Repos, summarize(p, list, stats, idleGap))
+	}
+	return r, nil
+}
+
+func summarize(path string, list []gitops.Autosave, stats map[string][]gitops.FileStat, idleGap time.Duration) Repo {
+	repo := Repo{Path: path, Autosaves: len(list)}
+	sort.Slice(list, func(i, j int) bool { return list[i].When.Before(list[j].When) })
+
+	days := map[string]*Day{}
+	files := map[string]*FileCount{}
+	var cur *Session
+	var curDay *Day
+	closeSession := func() {
+		if cur == nil {
+			return
+		}
+		cur.Active = cur.End.Sub(cur.Start)
+		repo.Sessions = append(repo.Sessions, *cur)
+		repo.Active += cur.Active
+		curDay.Active += cur.Active
+		cur = nil
+	}
+
+	for _, a := range list {
+		start := a.Note.BatchStart
+		if start.IsZero() || start.After(a.When) {
+			start = a.When
+		}
+		if cur == nil || start.Sub(cur.End) > idleGap {
+			closeSession()
+			cur = &Session{Start: start, End: a.When}
+			date := start.Local().Format("2006-01-02")
+			if days[date] == nil {
+				days[date] = &Day{Date: date}
+			}
+			curDay = days[date]
+			curDay.Sessions++
+		}
+		if a.When.After(cur.End) {
+			cur.End = a.When
+		}
+		cur.Autosaves++
+		curDay.Autosaves++
+		repo.Events += a.Note.Events
+		repo.Suppressed += a.Note.Suppressed
+
+		for _, st := range stats[a.Hash] {
+			repo.Added += st.Added
+			repo.Removed += st.Removed
+			curDay.Added += st.Added
+			curDay.Removed += st.Removed
+			fc := files[st.Path]
+			if fc == nil {
+				fc = &FileCount{Path: st.Path}
+				files[st.Path] = fc
+			}
+			fc.Autosaves++
+			fc.Added += st.Added
+			fc.Removed += st.Removed
+		}
+	}
+	closeSession()
+
+	for _, d := range days {
+		repo.Days = append(repo.Days, *d)
+	}
+	sort.Slice(repo.Days, func(i, j int) bool { return repo.Days[i].Date < repo.Days[j].Date })
+
+	for _, fc := range files {
+		repo.TopFiles = append(repo.TopFiles, *fc)
+	}
+	sort.Slice(repo.TopFiles, func(i, j int) bool {
+		a, b := repo.TopFiles[i], repo.TopFiles[j]
+		if a.Autosaves != b.Autosaves {
+			return a.Autosaves > b.Autosaves
+		}
+		if a.Added+a.Removed != b.Added+b.Removed {
+			return a.Added+a.Removed > b.Added+b.Removed
+		}
+		return a.Path < b.Path
+	})
+	if len(repo.TopFiles) > topFiles {
+		repo.TopFiles = repo.TopFiles[:topFiles]
+	}
+	return repo
+}
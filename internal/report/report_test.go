@@ -0,0 +1,93 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/gitops"
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestSummarize(t *testing.T) {
+	at := func(day, h, m int) time.Time { return time.Date(2024, 5, day, h, m, 0, 0, time.Local) }
+	list := []gitops.Autosave{
+		// out of order on purpose
+		{Hash: "c", When: at(1, 11, 0), Note: gitops.Note{BatchStart: at(1, 10, 40)}},
+		{Hash: "a", When: at(1, 9, 0), Note: gitops.Note{BatchStart: at(1, 8, 50), Events: 4, Suppressed: 1}},
+		{Hash: "b", When: at(1, 9, 20), Note: gitops.Note{BatchStart: at(1, 9, 10), Events: 2}},
+		{Hash: "d", When: at(2, 9, 0)}, // from trailers: no batch start
+	}
+	stats := map[string][]gitops.FileStat{
+		"a": {{Path: "a.go", Added: 3, Removed: 1}},
+		"b": {{Path: "a.go", Added: 1}, {Path: "b.go", Added: 10}},
+		"d": {{Path: "c.go", Removed: 5}},
+	}
+	r := summarize("repo", list, stats, 30*time.Minute)
+
+	if r.Autosaves != 4 || r.Events != 6 || r.Suppressed != 1 {
+		t.Errorf("autosaves %d, events %d, suppressed %d", r.Autosaves, r.Events, r.Suppressed)
+	}
+	if r.Added != 14 || r.Removed != 6 {
+		t.Errorf("lines +%d/-%d, want +14/-6", r.Added, r.Removed)
+	}
+	// 8:50–9:20, 10:40–11:00 and a moment on the 2nd
+	if len(r.Sessions) != 3 {
+		t.Fatalf("sessions = %+v", r.Sessions)
+	}
+	if r.Sessions[0].Active != 30*time.Minute || r.Sessions[0].Autosaves != 2 {
+		t.Errorf("first session = %+v", r.Sessions[0])
+	}
+	if r.Sessions[2].Active != 0 || !r.Sessions[2].Start.Equal(at(2, 9, 0)) {
+		t.Errorf("trailer-only session = %+v", r.Sessions[2])
+	}
+	if r.Active != 50*time.Minute {
+		t.Errorf("active = %s, want 50m", r.Active)
+	}
+	if len(r.Days) != 2 || r.Days[0].Date != "2024-05-01" || r.Days[0].Sessions != 2 || r.Days[0].Added != 14 || r.Days[1].Removed != 5 {
+		t.Errorf("days = %+v", r.Days)
+	}
+	if len(r.TopFiles) != 3 || r.TopFiles[0].Path != "a.go" || r.TopFiles[0].Autosaves != 2 || r.TopFiles[1].Path != "b.go" {
+		t.Errorf("top files = %+v", r.TopFiles)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	root := testutil.NewRepo(t)
+	testutil.Commit(t, root, "a.txt", "1\n", "by hand")
+	testutil.Commit(t, root, "a.txt", "1\n2\n3\n", "autosave")
+	if err := gitops.WriteNote(root, "HEAD", gitops.Note{Reason: "idle"}); err != nil {
+		t.Fatal(err)
+	}
+	testutil.Commit(t, root, "b.txt", "x\n", "autosave")
+	if err := gitops.WriteNote(root, "HEAD", gitops.Note{Reason: "batch"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Build([]string{root}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := r.Repos[0]
+	if repo.Autosaves != 2 || repo.Added != 3 || len(repo.Sessions) != 1 {
+		t.Errorf("autosaves %d, added %d, sessions %d; want 2, 3, 1", repo.Autosaves, repo.Added, len(repo.Sessions))
+	}
+}
+
+func TestBuildFallsBackToTrailers(t *testing.T) {
+	root := testutil.NewRepo(t)
+	testutil.Commit(t, root, "a.txt", "1\n", "by hand")
+	testutil.Commit(t, root, "a.txt", "1\n2\n3\n", "autosave\n\nAutosave-Reason: idle")
+	testutil.Commit(t, root, "b.txt", "x\n", "autosave")
+	if err := gitops.WriteNote(root, "HEAD", gitops.Note{Reason: "batch", Events: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Build([]string{root}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := r.Repos[0]
+	if repo.Autosaves != 2 || repo.Added != 3 || repo.Events != 7 {
+		t.Errorf("autosaves %d, added %d, events %d; want 2, 3, 7", repo.Autosaves, repo.Added, repo.Events)
+	}
+}
@@ -0,0 +1,61 @@
+// Package testutil sets up throwaway git repositories for tests.
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// NewRepo returns an empty repository on branch work in a temporary
+// directory. git runs with a test identity and without the user's global and
+// system config. The test is skipped when git isn't installed.
+func NewRepo(t testing.TB) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root, home := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, kv := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(kv, "test")
+	}
+	Git(t, root, "init", "-q", "-b", "work")
+	return root
+}
+
+// Git runs git in dir and returns its trimmed output, failing the test when
+// git does.
+func Git(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Write creates rel below root with content, making its directories.
+func Write(t testing.TB, root, rel, content string) {
+	t.Helper()
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Commit writes rel, commits it with msg and returns the new commit.
+func Commit(t testing.TB, root, rel, content, msg string) string {
+	t.Helper()
+	Write(t, root, rel, content)
+	Git(t, root, "add", "--", rel)
+	Git(t, root, "commit", "-q", "-m", msg)
+	return Git(t, root, "rev-parse", "HEAD")
+}
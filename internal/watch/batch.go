@@ -0,0 +1,365 @@
+package watch
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Op is what happened to a path. Several ops can be set when a path changed
+// more than once within a batch.
+type Op uint8
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+var opNames = []string{"create", "write", "remove", "rename", "chmod"}
+
+func (o Op) String() string {
+	var parts []string
+	for i, n := range opNames {
+		if o&(1<<i) != 0 {
+			parts = append(parts, n)
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+func opOf(ev fsnotify.Op) Op {
+	var o Op
+	if ev&fsnotify.Create != 0 {
+		o |= Create
+	}
+	if ev&fsnotify.Write != 0 {
+		o |= Write
+	}
+	if ev&fsnotify.Remove != 0 {
+		o |= Remove
+	}
+	if ev&fsnotify.Rename != 0 {
+		o |= Rename
+	}
+	if ev&fsnotify.Chmod != 0 {
+		o |= Chmod
+	}
+	return o
+}
+
+// Batch is every change seen during one debounce window.
+type Batch struct {
+	Paths  map[string]Op // repo-relative, forward slashes
+	First  time.Time
+	Last   time.Time
+	Events int
+	// Renames pairs moved paths, old -> new. Both ends are also in Paths.
+	Renames map[string]string
+	// Suppressed counts events dropped because content didn't change.
+	Suppressed int
+	// Rescan marks a batch synthesized from git status after events were
+	// lost; Paths then holds everything dirty, not just what changed.
+	Rescan bool
+}
+
+func (b *Batch) add(rel string, op Op, at time.Time) {
+	if b.Paths == nil {
+		b.Paths = map[string]Op{}
+	}
+	b.touch(at)
+	// a backup-then-rewrite save (foo -> foo~, new foo, rm foo~) is a write of foo
+	if op&Remove != 0 {
+		if src := b.renamedFrom(rel); src != "" && b.Paths[src]&Create != 0 {
+			delete(b.Renames, src)
+			delete(b.Paths, rel)
+			b.Paths[src] = Write
+			return
+		}
+	}
+	b.Paths[rel] |= op
+}
+
+// move records that old was renamed to new. A file created in this batch and
+// renamed over another is a temp file from an atomic save and collapses into
+// a write of the target; a chain of moves collapses into one.
+func (b *Batch) move(old, new string, at time.Time) {
+	if b.Paths == nil {
+		b.Paths = map[string]Op{}
+	}
+	b.touch(at)
+	if src := b.renamedFrom(old); src != "" {
+		delete(b.Renames, src)
+		delete(b.Paths, old)
+		b.Paths[new] |= Create
+		if src != new {
+			b.Renames[src] = new
+		} else {
+			b.Paths[new] = Write // moved back where it started
+		}
+		return
+	}
+	if b.Paths[old]&Create != 0 {
+		delete(b.Paths, old)
+		b.Paths[new] |= Write
+		return
+	}
+	if b.Renames == nil {
+		b.Renames = map[string]string{}
+	}
+	b.Paths[old] |= Rename
+	b.Paths[new] |= Create
+	b.Renames[old] = new
+}
+
+// renamedFrom returns the path that was moved to rel in this batch, if any.
+func (b *Batch) renamedFrom(rel string) string {
+	for old, new := range b.Renames {
+		if new == rel {
+			return old
+		}
+	}
+	return ""
+}
+
+func (b *Batch) touch(at time.Time) {
+	if b.First.IsZero() || at.Before(b.First) {
+		b.First = at
+	}
+	if at.After(b.Last) {
+		b.Last = at
+	}
+	b.Events++
+}
+
+// Merge folds o into b.
+func (b *Batch) Merge(o Batch) {
+	b.Suppressed += o.Suppressed
+	if o.Events == 0 {
+		return
+	}
+	b.Rescan = b.Rescan || o.Rescan
+	if b.Paths == nil {
+		b.Paths = map[string]Op{}
+	}
+	for p, op := range o.Paths {
+		b.Paths[p] |= op
+	}
+	for old, new := range o.Renames {
+		if b.Renames == nil {
+			b.Renames = map[string]string{}
+		}
+		if src := b.renamedFrom(old); src != "" {
+			delete(b.Renames, src)
+			old = src
+		}
+		b.Renames[old] = new
+	}
+	if b.First.IsZero() || o.First.Before(b.First) {
+		b.First = o.First
+	}
+	if o.Last.After(b.Last) {
+		b.Last = o.Last
+	}
+	b.Events += o.Events
+}
+
+// Split divides b's paths by key. A move goes with its new path, so both of
+// its ends are committed together. Events and suppressed events are shared
+// out in proportion to paths; a batch without paths splits into nothing.
+func (b Batch) Split(key func(rel string) int) map[int]Batch {
+	owner := make(map[string]int, len(b.Paths))
+	for p := range b.Paths {
+		owner[p] = key(p)
+	}
+	for old, new := range b.Renames {
+		owner[old] = owner[new]
+	}
+	out := map[int]Batch{}
+	for p, op := range b.Paths {
+		part, ok := out[owner[p]]
+		if !ok {
+			part = Batch{Paths: map[string]Op{}, First: b.First, Last: b.Last, Rescan: b.Rescan}
+		}
+		part.Paths[p] = op
+		out[owner[p]] = part
+	}
+	for old, new := range b.Renames {
+		part := out[owner[new]]
+		if part.Renames == nil {
+			part.Renames = map[string]string{}
+		}
+		part.Renames[old] = new
+		out[owner[new]] = part
+	}
+	keys := make([]int, 0, len(out))
+	for k := range out {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	n, seen := len(b.Paths), 0
+	for _, k := range keys {
+		part := out[k]
+		before := seen
+		seen += len(part.Paths)
+		// cumulative shares add up to the batch's totals
+		part.Events = max(1, b.Events*seen/n-b.Events*before/n)
+		part.Suppressed = b.Suppressed*seen/n - b.Suppressed*before/n
+		out[k] = part
+	}
+	return out
+}
+
+// Empty reports whether the batch holds no events.
+func (b Batch) Empty() bool { return b.Events == 0 }
+
+// Sorted returns the paths in lexical order.
+func (b Batch) Sorted() []string {
+	list := make([]string, 0, len(b.Paths))
+	for p := range b.Paths {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// coalescer accumulates events and delivers them as batches once a debounce
+// window passes without new events. A steady stream of events is still
+// delivered every maxWait, and a burst of burst events at once, so a bulk
+// operation shows up while it runs rather than after. Delivery never blocks
+// the caller: while the consumer is busy, later batches merge into the one
+// waiting to be sent.
+type coalescer struct {
+	debounce time.Duration
+	maxWait  time.Duration
+	burst    int // 0 disables
+	out      chan Batch
+	ready    chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	pending Batch // still inside the debounce window
+	outbox  Batch // debounced, waiting for the consumer
+	timer   *time.Timer
+}
+
+// newCoalescer returns a coalescer delivering after debounce, at most
+// max(2s, 2×debounce) after the first pending event, or at once when burst
+// events are pending.
+func newCoalescer(debounce time.Duration, burst int) *coalescer {
+	c := &coalescer{
+		debounce: debounce,
+		maxWait:  max(minMaxWait, 2*debounce),
+		burst:    burst,
+		out:      make(chan Batch),
+		ready:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go c.send()
+	return c
+}
+
+// add records one event and restarts the debounce window.
+func (c *coalescer) add(rel string, op Op) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending.add(rel, op, time.Now())
+	c.resetTimer()
+}
+
+// minMaxWait is the shortest a stream of events is held back.
+const minMaxWait = 2 * time.Second
+
+// resetTimer restarts the debounce window, cut short by maxWait and burst;
+// callers hold mu.
+func (c *coalescer) resetTimer() {
+	wait := c.debounce
+	if c.burst > 0 && c.pending.Events >= c.burst {
+		wait = 0
+	} else if left := c.maxWait - time.Since(c.pending.First); left < wait {
+		wait = max(left, 0)
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(wait, c.fire)
+	} else {
+		c.timer.Reset(wait)
+	}
+}
+
+// move records a rename pair and restarts the debounce window.
+func (c *coalescer) move(old, new string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending.move(old, new, time.Now())
+	c.resetTimer()
+}
+
+// suppress counts an event dropped as a no-op. It deliberately leaves the
+// debounce window alone; the count rides along with the next batch.
+func (c *coalescer) suppress() {
+	c.mu.Lock()
+	c.pending.Suppressed++
+	c.mu.Unlock()
+}
+
+// emit queues b for delivery right away, bypassing the debounce window.
+func (c *coalescer) emit(b Batch) {
+	c.mu.Lock()
+	c.outbox.Merge(b)
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *coalescer) fire() {
+	c.mu.Lock()
+	c.outbox.Merge(c.pending)
+	c.pending = Batch{}
+	c.mu.Unlock()
+	c.signal()
+}
+
+func (c *coalescer) signal() {
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (c *coalescer) send() {
+	defer close(c.out)
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.ready:
+		}
+		c.mu.Lock()
+		b := c.outbox
+		c.outbox = Batch{}
+		c.mu.Unlock()
+		if b.Empty() {
+			continue
+		}
+		select {
+		case c.out <- b:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close stops delivery and closes the output channel. Undelivered events are
+// dropped; a final flush commits from git status anyway.
+func (c *coalescer) close() {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
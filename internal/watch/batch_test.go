@@ -0,0 +1,189 @@
+package watch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCoalescerMergesWhileConsumerIsBusy(t *testing.T) {
+	c := newCoalescer(10*time.Millisecond, 0)
+	defer c.close()
+
+	c.add("a.txt", Write)
+	c.add("a.txt", Chmod)
+	c.add("b.txt", Create)
+	time.Sleep(40 * time.Millisecond) // first window closes; nobody is reading
+	c.add("c.txt", Remove)
+	time.Sleep(40 * time.Millisecond)
+
+	var got Batch
+	deadline := time.After(time.Second)
+	for got.Events < 4 {
+		select {
+		case b := <-c.out:
+			got.Merge(b)
+		case <-deadline:
+			t.Fatalf("timed out with %d events", got.Events)
+		}
+	}
+	want := map[string]Op{"a.txt": Write | Chmod, "b.txt": Create, "c.txt": Remove}
+	if len(got.Paths) != len(want) {
+		t.Fatalf("paths = %v, want %v", got.Paths, want)
+	}
+	for p, op := range want {
+		if got.Paths[p] != op {
+			t.Errorf("%s: op %v, want %v", p, got.Paths[p], op)
+		}
+	}
+	if got.First.After(got.Last) {
+		t.Errorf("first %v after last %v", got.First, got.Last)
+	}
+}
+
+func TestOpString(t *testing.T) {
+	if s := (Create | Write).String(); s != "create|write" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestBatchMoves(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name    string
+		run     func(b *Batch)
+		paths   map[string]Op
+		renames map[string]string
+	}{
+		{"move", func(b *Batch) {
+			b.add("a.go", Rename, now)
+			b.move("a.go", "pkg/a.go", now)
+		}, map[string]Op{"a.go": Rename, "pkg/a.go": Create}, map[string]string{"a.go": "pkg/a.go"}},
+		{"atomic save", func(b *Batch) {
+			b.add(".a.go.tmp123", Create, now)
+			b.add(".a.go.tmp123", Write, now)
+			b.add(".a.go.tmp123", Rename, now)
+			b.move(".a.go.tmp123", "a.go", now)
+		}, map[string]Op{"a.go": Write}, nil},
+		{"backup then rewrite", func(b *Batch) {
+			b.add("a.go", Rename, now)
+			b.move("a.go", "a.go~", now)
+			b.add("a.go", Create, now)
+			b.add("a.go", Write, now)
+			b.add("a.go~", Remove, now)
+		}, map[string]Op{"a.go": Write}, nil},
+		{"chain", func(b *Batch) {
+			b.add("a", Rename, now)
+			b.move("a", "b", now)
+			b.add("b", Rename, now)
+			b.move("b", "c", now)
+		}, map[string]Op{"a": Rename, "c": Create}, map[string]string{"a": "c"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var b Batch
+			tc.run(&b)
+			if len(b.Paths) != len(tc.paths) {
+				t.Errorf("paths = %v, want %v", b.Paths, tc.paths)
+			}
+			for p, op := range tc.paths {
+				if b.Paths[p] != op {
+					t.Errorf("%s = %v, want %v", p, b.Paths[p], op)
+				}
+			}
+			if len(b.Renames) != len(tc.renames) {
+				t.Errorf("renames = %v, want %v", b.Renames, tc.renames)
+			}
+			for o, n := range tc.renames {
+				if b.Renames[o] != n {
+					t.Errorf("rename %s = %q, want %q", o, b.Renames[o], n)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeChainsRenames(t *testing.T) {
+	now := time.Now()
+	var a, b Batch
+	a.move("x", "y", now)
+	b.move("y", "z", now)
+	a.Merge(b)
+	if len(a.Renames) != 1 || a.Renames["x"] != "z" {
+		t.Errorf("renames = %v", a.Renames)
+	}
+}
+
+func TestSplitByRule(t *testing.T) {
+	now := time.Now()
+	var b Batch
+	b.add("docs/a.md", Write, now)
+	b.add("src/main.go", Write, now)
+	b.add("src/util.go", Create, now)
+	b.move("src/old.md", "docs/old.md", now)
+	rules := []string{"docs/**"}
+	parts := b.Split(func(rel string) int {
+		if Matches(rules, rel) {
+			return 0
+		}
+		return 1
+	})
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	docs, rest := parts[0], parts[1]
+	if len(docs.Paths) != 3 || docs.Renames["src/old.md"] != "docs/old.md" {
+		t.Errorf("docs = %v, renames %v", docs.Paths, docs.Renames)
+	}
+	if len(rest.Paths) != 2 || rest.Paths["src/util.go"] != Create || rest.Renames != nil {
+		t.Errorf("rest = %v, renames %v", rest.Paths, rest.Renames)
+	}
+	if docs.Events+rest.Events != b.Events || docs.First != b.First {
+		t.Errorf("events %d+%d of %d", docs.Events, rest.Events, b.Events)
+	}
+}
+
+func TestCoalescerDeliversDuringSteadyStream(t *testing.T) {
+	c := newCoalescer(50*time.Millisecond, 0)
+	c.maxWait = 200 * time.Millisecond
+	defer c.close()
+
+	// events closer together than the debounce window, for longer than maxWait
+	start := time.Now()
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				c.add("a.txt", Write)
+			}
+		}
+	}()
+	defer close(stop)
+	select {
+	case <-c.out:
+		if d := time.Since(start); d > 400*time.Millisecond {
+			t.Errorf("first batch after %s, want about maxWait", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing delivered while events kept coming")
+	}
+}
+
+func TestCoalescerDeliversBurstAtOnce(t *testing.T) {
+	c := newCoalescer(time.Hour, 5)
+	defer c.close()
+	for i := 0; i < 5; i++ {
+		c.add(fmt.Sprintf("%d.txt", i), Create)
+	}
+	select {
+	case b := <-c.out:
+		if b.Events != 5 {
+			t.Errorf("got %d events, want 5", b.Events)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("burst not delivered")
+	}
+}
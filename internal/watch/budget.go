@@ -0,0 +1,105 @@
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// dirNode is a directory that needs a watch, with its watched descendants.
+type dirNode struct {
+	path     string
+	children []*dirNode
+	count    int       // directories in this subtree, itself included
+	newest   time.Time // latest directory mtime in this subtree
+}
+
+// scanDirs walks root and returns the tree of directories that aren't ignored.
+func scanDirs(root string, ig Matcher) (*dirNode, error) {
+	nodes := map[string]*dirNode{}
+	var top *dirNode
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && (d.Name() == ".git" || nestedRepo(path) || ig.Ignored(relPath(root, path), true)) {
+			return filepath.SkipDir
+		}
+		n := &dirNode{path: path}
+		if fi, err := d.Info(); err == nil {
+			n.newest = fi.ModTime()
+		}
+		nodes[path] = n
+		if path == root {
+			top = n
+		} else if parent := nodes[filepath.Dir(path)]; parent != nil {
+			parent.children = append(parent.children, n)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	top.total()
+	return top, nil
+}
+
+func (n *dirNode) total() {
+	n.count = 1
+	for _, c := range n.children {
+		c.total()
+		n.count += c.count
+		if c.newest.After(n.newest) {
+			n.newest = c.newest
+		}
+	}
+}
+
+func (n *dirNode) all(out []string) []string {
+	out = append(out, n.path)
+	for _, c := range n.children {
+		out = c.all(out)
+	}
+	return out
+}
+
+// planWatches fits n into budget watches. Subtrees modified most recently are
+// watched first; one that doesn't fit is split further, and what remains is
+// returned as subtrees to poll.
+func planWatches(n *dirNode, budget int) (watch, poll []string) {
+	if n.count <= budget {
+		return n.all(nil), nil
+	}
+	if budget < 1 {
+		return nil, []string{n.path}
+	}
+	watch = []string{n.path}
+	budget--
+	kids := append([]*dirNode(nil), n.children...)
+	sort.Slice(kids, func(i, j int) bool { return kids[i].newest.After(kids[j].newest) })
+	for _, c := range kids {
+		w, p := planWatches(c, budget)
+		budget -= len(w)
+		watch = append(watch, w...)
+		poll = append(poll, p...)
+	}
+	return watch, poll
+}
+
+// limitAdvice tells the user how to raise the inotify limit.
+func limitAdvice(limit, used, need int) string {
+	want := 65536
+	for want < (used+need)*2 {
+		want *= 2
+	}
+	return fmt.Sprintf("raise fs.inotify.max_user_watches (now %d, %d in use) with `sudo sysctl fs.inotify.max_user_watches=%d` "+
+		"and persist it in /etc/sysctl.d/90-autogit.conf", limit, used, want)
+}
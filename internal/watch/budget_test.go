@@ -0,0 +1,36 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPlanWatchesPrefersRecentSubtrees(t *testing.T) {
+	now := time.Now()
+	leaf := func(p string, age time.Duration) *dirNode { return &dirNode{path: p, newest: now.Add(-age)} }
+	old := &dirNode{path: "/r/old", newest: now.Add(-time.Hour), children: []*dirNode{leaf("/r/old/a", time.Hour), leaf("/r/old/b", time.Hour)}}
+	hot := &dirNode{path: "/r/hot", newest: now, children: []*dirNode{leaf("/r/hot/x", 0), leaf("/r/hot/y", time.Hour)}}
+	root := &dirNode{path: "/r", children: []*dirNode{old, hot}}
+	root.total()
+
+	watch, poll := planWatches(root, root.count)
+	if len(watch) != 7 || poll != nil {
+		t.Fatalf("full budget: watch %v poll %v", watch, poll)
+	}
+
+	watch, poll = planWatches(root, 5)
+	sort.Strings(watch)
+	if want := []string{"/r", "/r/hot", "/r/hot/x", "/r/hot/y", "/r/old"}; !reflect.DeepEqual(watch, want) {
+		t.Errorf("watch = %v, want %v", watch, want)
+	}
+	sort.Strings(poll)
+	if want := []string{"/r/old/a", "/r/old/b"}; !reflect.DeepEqual(poll, want) {
+		t.Errorf("poll = %v, want %v", poll, want)
+	}
+
+	if watch, poll = planWatches(root, 0); watch != nil || !reflect.DeepEqual(poll, []string{"/r"}) {
+		t.Errorf("no budget: watch %v poll %v", watch, poll)
+	}
+}
@@ -0,0 +1,54 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Busy returns the files among rels (relative to root) that are still being
+// written: their size or mtime changes during probe, or another process has
+// them open for writing. Paths that don't exist or aren't regular files are
+// never busy. A zero probe disables the check.
+func Busy(root string, rels []string, probe time.Duration) []string {
+	if probe <= 0 || len(rels) == 0 {
+		return nil
+	}
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r // /proc reports resolved paths
+	}
+	type stamp struct {
+		size  int64
+		mtime time.Time
+	}
+	before := make(map[string]stamp, len(rels))
+	for _, rel := range rels {
+		if fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rel))); err == nil && fi.Mode().IsRegular() {
+			before[rel] = stamp{fi.Size(), fi.ModTime()}
+		}
+	}
+	if len(before) == 0 {
+		return nil
+	}
+	time.Sleep(probe)
+
+	busy := map[string]bool{}
+	byAbs := make(map[string]string, len(before))
+	for rel, st := range before {
+		abs := filepath.Join(root, filepath.FromSlash(rel))
+		byAbs[abs] = rel
+		if fi, err := os.Lstat(abs); err == nil && (fi.Size() != st.size || !fi.ModTime().Equal(st.mtime)) {
+			busy[rel] = true
+		}
+	}
+	for abs := range openForWriting(byAbs) {
+		busy[byAbs[abs]] = true
+	}
+	list := make([]string, 0, len(busy))
+	for rel := range busy {
+		list = append(list, rel)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,58 @@
+package watch
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestBusy(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"done.txt", "growing.bin", "held.bin"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		f, _ := os.OpenFile(filepath.Join(root, "growing.bin"), os.O_APPEND|os.O_WRONLY, 0)
+		defer f.Close()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				f.Write([]byte("more"))
+			}
+		}
+	}()
+	want := []string{"growing.bin"}
+	if runtime.GOOS == "linux" {
+		// another process holding the file open for writing
+		cmd := exec.Command("sh", "-c", "exec 3>>held.bin; sleep 5")
+		cmd.Dir = root
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Process.Kill()
+		time.Sleep(100 * time.Millisecond)
+		want = append(want, "held.bin")
+	}
+
+	got := Busy(root, []string{"done.txt", "growing.bin", "held.bin", "gone.txt"}, 50*time.Millisecond)
+	if len(got) != len(want) {
+		t.Fatalf("Busy = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Busy = %v, want %v", got, want)
+		}
+	}
+	if got := Busy(root, []string{"growing.bin"}, 0); got != nil {
+		t.Errorf("zero probe: Busy = %v", got)
+	}
+}
@@ -0,0 +1,267 @@
+package watch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+)
+
+// Matcher decides whether repo-relative, forward-slash paths are ignored.
+type Matcher interface {
+	Ignored(rel string, isDir bool) bool
+	// Invalidate drops cached rules after an ignore file changed.
+	Invalidate()
+	Close() error
+}
+
+// NewMatcher returns the ignore engine selected by rc.IgnoreEngine. Noise
+// profile patterns count as custom excludes, and rc.Includes narrows it.
+func NewMatcher(rc config.RepoConfig) Matcher {
+	noise, _ := rc.NoisePatterns()
+	excludes := append(append([]string{}, rc.Excludes...), noise...)
+	if rc.ParseIgnore && rc.IgnoreEngine == "git" {
+		return newScope(newCheckIgnore(rc.Path, excludes), rc.Includes)
+	}
+	return newScope(NewIgnore(rc.Path, rc.ParseIgnore, excludes), rc.Includes)
+}
+
+// checker is implemented by matchers that answer many paths in one call.
+type checker interface {
+	Check(rels []string) map[string]bool
+}
+
+// prefetch warms ig's cache for rels with a single query, so the Ignored
+// calls that follow don't each make a round trip.
+func prefetch(ig Matcher, rels []string) {
+	if s, ok := ig.(*scope); ok {
+		in := rels[:0:0]
+		for _, rel := range rels {
+			if s.included(rel) {
+				in = append(in, rel)
+			}
+		}
+		ig, rels = s.Matcher, in
+	}
+	if c, ok := ig.(checker); ok && len(rels) > 1 {
+		c.Check(rels)
+	}
+}
+
+// sourcePoll is how often the ignore files outside the worktree are stat'ed.
+const sourcePoll = 2 * time.Second
+
+// checkIgnore asks a long-lived `git check-ignore --stdin` coprocess, so
+// results match git exactly. Answers are cached per directory; the cache and
+// the process are dropped whenever an ignore source changes, since git keeps
+// the patterns it has read. If git can't be run, the builtin matcher answers.
+type checkIgnore struct {
+	root     string
+	excludes *Ignore // custom excludes always win
+	fallback *Ignore
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	cache   map[string]map[string]bool // dir -> base name -> ignored
+	sources *stamps
+	checked time.Time
+}
+
+func newCheckIgnore(root string, excludes []string) *checkIgnore {
+	c := &checkIgnore{
+		root:     root,
+		excludes: NewIgnore(root, false, excludes),
+		cache:    map[string]map[string]bool{},
+	}
+	c.sources = newStamps(ignoreSources(root))
+	c.checked = time.Now()
+	return c
+}
+
+func (c *checkIgnore) Ignored(rel string, isDir bool) bool {
+	rel = cleanRel(rel)
+	if rel == "" {
+		return false
+	}
+	if c.excludes.Ignored(rel, isDir) {
+		return true
+	}
+	return c.Check([]string{rel})[rel]
+}
+
+// Check answers for a batch of paths with one round trip for the cache
+// misses. Unlike Ignored it doesn't apply the custom excludes.
+func (c *checkIgnore) Check(rels []string) map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pollSources()
+
+	res := make(map[string]bool, len(rels))
+	var miss []string
+	for _, rel := range rels {
+		if v, ok := c.cache[path.Dir(rel)][path.Base(rel)]; ok {
+			res[rel] = v
+		} else {
+			miss = append(miss, rel)
+		}
+	}
+	if len(miss) == 0 {
+		return res
+	}
+
+	got, err := c.query(miss)
+	if err != nil {
+		// one retry with a fresh process, then fall back to the builtin engine
+		c.stop()
+		if got, err = c.query(miss); err != nil {
+			c.stop()
+			if c.fallback == nil {
+				c.fallback = NewIgnore(c.root, true, nil)
+			}
+			for _, rel := range miss {
+				fi, statErr := os.Lstat(filepath.Join(c.root, filepath.FromSlash(rel)))
+				res[rel] = c.fallback.Ignored(rel, statErr == nil && fi.IsDir())
+			}
+			return res
+		}
+	}
+	for rel, v := range got {
+		dir := path.Dir(rel)
+		if c.cache[dir] == nil {
+			c.cache[dir] = map[string]bool{}
+		}
+		c.cache[dir][path.Base(rel)] = v
+		res[rel] = v
+	}
+	return res
+}
+
+// queryTimeout bounds one round trip to the coprocess; a git that takes
+// longer is killed and restarted.
+const queryTimeout = 5 * time.Second
+
+// query sends paths to the coprocess. With --verbose --non-matching every
+// path yields four NUL-terminated fields: source, line, pattern, path. An
+// empty pattern means no match, a "!" pattern means re-included. Paths are
+// written from another goroutine while answers are read, so a large batch
+// can't fill both pipes and deadlock.
+func (c *checkIgnore) query(rels []string) (map[string]bool, error) {
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, rel := range rels {
+		b.WriteString(rel)
+		b.WriteByte(0)
+	}
+	stdin, stdout := c.stdin, c.stdout
+	go io.WriteString(stdin, b.String()) // fails once stop closes the pipe
+
+	type answer struct {
+		res map[string]bool
+		err error
+	}
+	got := make(chan answer, 1)
+	go func() {
+		res, err := readAnswers(stdout, len(rels))
+		got <- answer{res, err}
+	}()
+	select {
+	case a := <-got:
+		return a.res, a.err
+	case <-time.After(queryTimeout):
+		c.stop() // unblocks both goroutines
+		return nil, fmt.Errorf("git check-ignore: no answer within %s", queryTimeout)
+	}
+}
+
+// readAnswers reads n answers of the coprocess.
+func readAnswers(r *bufio.Reader, n int) (map[string]bool, error) {
+	res := make(map[string]bool, n)
+	for range n {
+		var f [4]string
+		for i := range f {
+			s, err := r.ReadString(0)
+			if err != nil {
+				return nil, fmt.Errorf("git check-ignore: %w", err)
+			}
+			f[i] = strings.TrimSuffix(s, "\x00")
+		}
+		res[f[3]] = f[2] != "" && !strings.HasPrefix(f[2], "!")
+	}
+	return res, nil
+}
+
+func (c *checkIgnore) start() error {
+	if c.cmd != nil {
+		return nil
+	}
+	cmd := exec.Command("git", "--no-optional-locks", "check-ignore", "--stdin", "-z", "--non-matching", "--verbose")
+	cmd.Dir = c.root
+	cmd.Env = append(os.Environ(), "GIT_FLUSH=1")
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	c.cmd, c.stdin, c.stdout = cmd, in, bufio.NewReader(out)
+	return nil
+}
+
+func (c *checkIgnore) stop() {
+	if c.cmd == nil {
+		return
+	}
+	c.stdin.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	c.cmd, c.stdin, c.stdout = nil, nil, nil
+}
+
+// Invalidate drops the cache and restarts git so it rereads every source.
+func (c *checkIgnore) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidate()
+}
+
+func (c *checkIgnore) invalidate() {
+	c.cache = map[string]map[string]bool{}
+	c.fallback = nil
+	c.stop()
+}
+
+// pollSources invalidates when info/exclude or core.excludesFile changed;
+// the watcher never sees those files.
+func (c *checkIgnore) pollSources() {
+	if time.Since(c.checked) < sourcePoll {
+		return
+	}
+	c.checked = time.Now()
+	if c.sources.changed() {
+		c.invalidate()
+	}
+}
+
+func (c *checkIgnore) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+	return nil
+}
@@ -0,0 +1,115 @@
+package watch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dedupHashMax bounds the files hashed on the event goroutine. Larger ones
+// are judged by size, mtime and exec bit alone, so touching one counts as a
+// change but draining events never waits on reading it.
+const dedupHashMax = 1 << 20
+
+// fileSum is what dedup remembers of a file's last seen content.
+type fileSum struct {
+	size  int64 // -1 until stat'ed; seeded entries only know the blob
+	mtime time.Time
+	exec  bool
+	blob  string // git blob id of the content
+}
+
+// dedup drops events that leave a file's content as it was, such as a
+// build tool touching files or an IDE rewriting identical bytes. The cache
+// starts from the index, so the first touch of a clean file is a no-op too;
+// contents are hashed like git blobs to compare against it.
+type dedup struct {
+	root   string
+	sha256 bool // repo uses the sha256 object format
+
+	mu    sync.Mutex
+	known map[string]fileSum
+}
+
+func newDedup(root string) *dedup {
+	d := &dedup{root: root, known: map[string]fileSum{}}
+	out, err := exec.Command("git", "--no-optional-locks", "-C", root, "ls-files", "-s", "-z").Output()
+	if err != nil {
+		return d
+	}
+	// <mode> <blob> <stage>\t<path>
+	for _, rec := range bytes.Split(out, []byte{0}) {
+		meta, path, ok := bytes.Cut(rec, []byte{'\t'})
+		if !ok {
+			continue
+		}
+		var mode, blob string
+		var stage int
+		if _, err := fmt.Sscanf(string(meta), "%s %s %d", &mode, &blob, &stage); err != nil || stage != 0 {
+			continue
+		}
+		d.known[string(path)] = fileSum{size: -1, exec: mode == "100755", blob: blob}
+		d.sha256 = len(blob) == 64
+	}
+	return d
+}
+
+// changed reports whether the event on rel may have changed its content or
+// exec bit, and remembers what it saw. Anything it can't judge is a change.
+func (d *dedup) changed(rel string) bool {
+	fi, err := os.Lstat(filepath.Join(d.root, filepath.FromSlash(rel)))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil || !fi.Mode().IsRegular() {
+		delete(d.known, rel)
+		return true
+	}
+	cur := fileSum{size: fi.Size(), mtime: fi.ModTime(), exec: fi.Mode()&0o111 != 0}
+	prev, ok := d.known[rel]
+	if ok && prev.size == cur.size && prev.mtime.Equal(cur.mtime) && prev.exec == cur.exec {
+		return false
+	}
+	if cur.size > dedupHashMax {
+		d.known[rel] = cur // blob unknown
+		return true
+	}
+	if cur.blob, err = d.blobID(rel, fi.Size()); err != nil {
+		delete(d.known, rel)
+		return true
+	}
+	d.known[rel] = cur
+	return !ok || prev.blob != cur.blob || prev.exec != cur.exec
+}
+
+// forget drops rel after it was removed or renamed away.
+func (d *dedup) forget(rel string) {
+	d.mu.Lock()
+	delete(d.known, rel)
+	d.mu.Unlock()
+}
+
+func (d *dedup) blobID(rel string, size int64) (string, error) {
+	f, err := os.Open(filepath.Join(d.root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var h hash.Hash = sha1.New()
+	if d.sha256 {
+		h = sha256.New()
+	}
+	fmt.Fprintf(h, "blob %d\x00", size)
+	if n, err := io.Copy(h, f); err != nil || n != size {
+		return "", fmt.Errorf("%s changed while hashing", rel)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestDedupDropsNoOpEvents(t *testing.T) {
+	root := testutil.NewRepo(t)
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	file := filepath.Join(root, "a.txt")
+	write := func(s string) {
+		if err := os.WriteFile(file, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch := func() {
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(file, later, later)
+	}
+	write("hello\n")
+	git("add", "a.txt")
+
+	d := newDedup(root)
+	steps := []struct {
+		name string
+		do   func()
+		want bool
+	}{
+		{"touch clean file", touch, false},
+		{"rewrite same bytes", func() { write("hello\n") }, false},
+		{"new content", func() { write("bye\n") }, true},
+		{"unchanged stat", func() {}, false},
+		{"back to original", func() { write("hello\n") }, true},
+		{"exec bit", func() { os.Chmod(file, 0o755) }, true},
+	}
+	for _, s := range steps {
+		s.do()
+		if got := d.changed("a.txt"); got != s.want {
+			t.Errorf("%s: changed = %v, want %v", s.name, got, s.want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(root, "new.txt"), []byte("x"), 0o644)
+	if !d.changed("new.txt") {
+		t.Error("untracked file's first event suppressed")
+	}
+	if d.changed("new.txt") {
+		t.Error("repeat event on new.txt not suppressed")
+	}
+}
+
+func TestDedupComparesLargeFilesByStat(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "big.bin")
+	if err := os.WriteFile(file, make([]byte, dedupHashMax+1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := newDedup(root)
+	if !d.changed("big.bin") {
+		t.Error("first event on big.bin suppressed")
+	}
+	if d.changed("big.bin") {
+		t.Error("repeat event with the same stat not suppressed")
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(file, later, later)
+	if !d.changed("big.bin") {
+		t.Error("touched big.bin counted as unchanged without hashing")
+	}
+	if _, ok := d.known["big.bin"]; !ok || d.known["big.bin"].blob != "" {
+		t.Errorf("big.bin cached as %+v, want stat only", d.known["big.bin"])
+	}
+}
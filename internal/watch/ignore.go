@@ -0,0 +1,426 @@
+package watch
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whrit/autoGit/internal/gitops"
+)
+
+// Ignore decides whether repo paths are ignored, following gitignore(5):
+// per-directory .gitignore files (loaded lazily, deepest wins),
+// $GIT_DIR/info/exclude and core.excludesFile, with negation, anchoring,
+// directory-only patterns and "**". A path inside an ignored directory is
+// always ignored. Custom excludes use the same syntax and win over everything.
+//
+// All paths are relative to the repo root and use forward slashes.
+type Ignore struct {
+	root       string
+	parse      bool // read gitignore sources, not just excludes
+	ignoreCase bool
+
+	mu      sync.Mutex
+	dirs    map[string][]pattern // .gitignore per directory, "" for root
+	info    []pattern
+	global  []pattern
+	exclude []pattern
+}
+
+type pattern struct {
+	base     string // directory the pattern is relative to, "" for root
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool // contains a slash: match the path relative to base, not the basename
+}
+
+// NewIgnore loads the ignore sources for the repo at root. When parse is
+// false only excludes apply.
+func NewIgnore(root string, parse bool, excludes []string) *Ignore {
+	ig := &Ignore{root: root, parse: parse}
+	for _, e := range excludes {
+		if p, ok := parsePattern(e, ""); ok {
+			ig.exclude = append(ig.exclude, p)
+		}
+	}
+	ig.load()
+	return ig
+}
+
+// load (re)reads the repo-wide sources; .gitignore files are read lazily.
+func (ig *Ignore) load() {
+	ig.dirs = map[string][]pattern{}
+	if !ig.parse {
+		return
+	}
+	ig.info = nil
+	if gitDir, err := gitops.GitDir(ig.root); err == nil {
+		ig.info = readPatterns(filepath.Join(gitDir, "info", "exclude"), "")
+	}
+	ig.global = readPatterns(excludesFile(ig.root), "")
+	ig.ignoreCase = gitops.Config(ig.root, "--bool", "core.ignorecase") == "true"
+}
+
+// Invalidate forgets every loaded ignore file so edits take effect.
+func (ig *Ignore) Invalidate() {
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	ig.load()
+}
+
+// Close implements Matcher.
+func (ig *Ignore) Close() error { return nil }
+
+// Ignored reports whether rel (a file, or a directory when isDir) is ignored.
+func (ig *Ignore) Ignored(rel string, isDir bool) bool {
+	rel = cleanRel(rel)
+	if rel == "" {
+		return false
+	}
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if ig.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return ig.match(rel, isDir)
+}
+
+func (ig *Ignore) match(rel string, isDir bool) bool {
+	if m, ok := lastMatch(ig.exclude, rel, isDir, ig.ignoreCase); ok && m {
+		return true
+	}
+	if !ig.parse {
+		return false
+	}
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		if m, ok := lastMatch(ig.dirPatterns(dir), rel, isDir, ig.ignoreCase); ok {
+			return m
+		}
+		if dir == "" {
+			break
+		}
+	}
+	if m, ok := lastMatch(ig.info, rel, isDir, ig.ignoreCase); ok {
+		return m
+	}
+	m, _ := lastMatch(ig.global, rel, isDir, ig.ignoreCase)
+	return m
+}
+
+// dirPatterns returns the .gitignore patterns of dir, reading them on first use.
+func (ig *Ignore) dirPatterns(dir string) []pattern {
+	if ps, ok := ig.dirs[dir]; ok {
+		return ps
+	}
+	ps := readPatterns(filepath.Join(ig.root, filepath.FromSlash(dir), ".gitignore"), dir)
+	ig.dirs[dir] = ps
+	return ps
+}
+
+// lastMatch applies patterns in order; the last one matching decides.
+// ok is false when none match.
+func lastMatch(ps []pattern, rel string, isDir, fold bool) (ignored, ok bool) {
+	for i := len(ps) - 1; i >= 0; i-- {
+		if ps[i].matches(rel, isDir, fold) {
+			return !ps[i].negate, true
+		}
+	}
+	return false, false
+}
+
+func (p pattern) matches(rel string, isDir, fold bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	glob := p.glob
+	if fold {
+		glob, rel = strings.ToLower(glob), strings.ToLower(rel)
+	}
+	if !p.anchored {
+		return wildmatch(glob, path.Base(rel))
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return wildmatch(glob, rel)
+}
+
+// parsePattern parses one gitignore line found in directory base.
+func parsePattern(line, base string) (pattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+	p := pattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") && !strings.HasSuffix(line, "\\/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	p.glob = line
+	return p, true
+}
+
+// trimTrailingSpace drops unescaped trailing spaces.
+func trimTrailingSpace(s string) string {
+	for strings.HasSuffix(s, " ") {
+		if strings.HasSuffix(s, "\\ ") {
+			// keep the space, drop the escape
+			return s[:len(s)-2] + " "
+		}
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func readPatterns(file, base string) []pattern {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var ps []pattern
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if p, ok := parsePattern(s.Text(), base); ok {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// ignoreSources lists the ignore files fsnotify never reports because they
+// live outside the worktree: $GIT_DIR/info/exclude and core.excludesFile.
+func ignoreSources(root string) []string {
+	var files []string
+	if gitDir, err := gitops.GitDir(root); err == nil {
+		files = append(files, filepath.Join(gitDir, "info", "exclude"))
+	}
+	return append(files, excludesFile(root))
+}
+
+// stamps remembers modification times to notice edits by polling.
+type stamps struct {
+	files  []string
+	mtimes []time.Time
+}
+
+func newStamps(files []string) *stamps {
+	s := &stamps{files: files}
+	s.mtimes = s.stat()
+	return s
+}
+
+// changed reports whether any file was modified, created or removed since
+// the last call.
+func (s *stamps) changed() bool {
+	mt := s.stat()
+	for i := range mt {
+		if !mt[i].Equal(s.mtimes[i]) {
+			s.mtimes = mt
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stamps) stat() []time.Time {
+	mt := make([]time.Time, len(s.files))
+	for i, f := range s.files {
+		if fi, err := os.Stat(f); err == nil {
+			mt[i] = fi.ModTime()
+		}
+	}
+	return mt
+}
+
+// excludesFile is core.excludesFile, or git's XDG default.
+func excludesFile(root string) string {
+	if f := gitops.Config(root, "--path", "core.excludesFile"); f != "" {
+		return f
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "git", "ignore")
+}
+
+func cleanRel(rel string) string {
+	rel = path.Clean(filepath.ToSlash(rel))
+	if rel == "." || rel == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(rel, "./")
+}
+
+// wildmatch matches text against a gitignore glob with git's WM_PATHNAME
+// rules: "*", "?" and classes never match "/", while "**" between slashes
+// (or at either end) matches any number of directories.
+func wildmatch(pat, text string) bool {
+	return wild(pat, 0, text)
+}
+
+func wild(pat string, pi int, text string) bool {
+	ti := 0
+	for pi < len(pat) {
+		c := pat[pi]
+		switch c {
+		case '\\':
+			pi++
+			if pi >= len(pat) || ti >= len(text) || text[ti] != pat[pi] {
+				return false
+			}
+			pi++
+			ti++
+		case '?':
+			if ti >= len(text) || text[ti] == '/' {
+				return false
+			}
+			pi++
+			ti++
+		case '*':
+			start := pi
+			for pi < len(pat) && pat[pi] == '*' {
+				pi++
+			}
+			matchSlash := false
+			if pi-start >= 2 {
+				atStart := start == 0 || pat[start-1] == '/'
+				atEnd := pi == len(pat) || pat[pi] == '/'
+				if atStart && atEnd {
+					matchSlash = true
+					// "a/**/b" also matches "a/b"
+					if pi < len(pat) && pat[pi] == '/' && wild(pat, pi+1, text[ti:]) {
+						return true
+					}
+				}
+			}
+			if pi == len(pat) {
+				return matchSlash || !strings.Contains(text[ti:], "/")
+			}
+			for ; ti <= len(text); ti++ {
+				if wild(pat, pi, text[ti:]) {
+					return true
+				}
+				if ti < len(text) && text[ti] == '/' && !matchSlash {
+					return false
+				}
+			}
+			return false
+		case '[':
+			if ti >= len(text) || text[ti] == '/' {
+				return false
+			}
+			next, ok := matchClass(pat, pi, text[ti])
+			if next < 0 || !ok {
+				return false
+			}
+			pi = next
+			ti++
+		default:
+			if ti >= len(text) || text[ti] != c {
+				return false
+			}
+			pi++
+			ti++
+		}
+	}
+	return ti == len(text)
+}
+
+var posixClasses = map[string]func(byte) bool{
+	"alnum":  func(b byte) bool { return isAlpha(b) || isDigit(b) },
+	"alpha":  isAlpha,
+	"blank":  func(b byte) bool { return b == ' ' || b == '\t' },
+	"cntrl":  func(b byte) bool { return b < 32 || b == 127 },
+	"digit":  isDigit,
+	"graph":  func(b byte) bool { return b > 32 && b < 127 },
+	"lower":  func(b byte) bool { return b >= 'a' && b <= 'z' },
+	"print":  func(b byte) bool { return b >= 32 && b < 127 },
+	"punct":  func(b byte) bool { return b > 32 && b < 127 && !isAlpha(b) && !isDigit(b) },
+	"space":  func(b byte) bool { return strings.IndexByte(" \t\n\r\f\v", b) >= 0 },
+	"upper":  func(b byte) bool { return b >= 'A' && b <= 'Z' },
+	"xdigit": func(b byte) bool { return isDigit(b) || (b|0x20 >= 'a' && b|0x20 <= 'f') },
+}
+
+func isAlpha(b byte) bool { return (b|0x20) >= 'a' && (b|0x20) <= 'z' }
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// matchClass matches ch against the bracket expression at pat[pi] and returns
+// the index after it; next is -1 for an unterminated class.
+func matchClass(pat string, pi int, ch byte) (next int, ok bool) {
+	pi++ // '['
+	negate := false
+	if pi < len(pat) && (pat[pi] == '!' || pat[pi] == '^') {
+		negate = true
+		pi++
+	}
+	matched := false
+	first := true
+	for pi < len(pat) {
+		c := pat[pi]
+		if c == ']' && !first {
+			return pi + 1, matched != negate
+		}
+		first = false
+		switch {
+		case c == '[' && pi+1 < len(pat) && pat[pi+1] == ':':
+			end := strings.Index(pat[pi+2:], ":]")
+			if end < 0 {
+				return -1, false
+			}
+			if fn, ok := posixClasses[pat[pi+2:pi+2+end]]; ok && fn(ch) {
+				matched = true
+			}
+			pi += end + 4
+			continue
+		case c == '\\' && pi+1 < len(pat):
+			pi++
+			c = pat[pi]
+		}
+		lo := c
+		pi++
+		if pi+1 < len(pat) && pat[pi] == '-' && pat[pi+1] != ']' {
+			hi := pat[pi+1]
+			pi += 2
+			if hi == '\\' && pi < len(pat) {
+				hi = pat[pi]
+				pi++
+			}
+			if lo <= ch && ch <= hi {
+				matched = true
+			}
+			continue
+		}
+		if ch == lo {
+			matched = true
+		}
+	}
+	return -1, false
+}
@@ -0,0 +1,312 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+// ignoreFixture is a repo layout with ignore files in every supported place.
+// Paths ending in "/" are directories.
+var ignoreFixture = struct {
+	files map[string]string
+	paths []string
+}{
+	files: map[string]string{
+		".gitignore": strings.Join([]string{
+			"# comment",
+			"*.log",
+			"!keep.log",
+			"/build",
+			"logs/",
+			"doc/**/*.pdf",
+			"**/cache",
+			"a/**/z",
+			"tmp*/",
+			"\\#hash",
+			"\\!bang",
+			"trailing   ",
+			"esc\\ ",
+			"*.[oa]",
+			"[!x]y.bak",
+			"file[[:digit:]].txt",
+			"only/dir/",
+			"vendor/*",
+			"!vendor/keep/",
+			"out/",
+			"!out/important.txt",
+		}, "\n"),
+		"sub/.gitignore":        "*.tmp\n!important.log\n/local\nnested/deep.txt\n",
+		"sub/inner/.gitignore":  "!*.tmp\n",
+		"info-exclude":          "secret.*\n!secret.md\n",
+		"global-ignore":         "*.swp\n.DS_Store\n",
+		"negated/.gitignore":    "*\n!*/\n!*.go\n",
+		"anch/.gitignore":       "/top.txt\nmid/x.txt\n",
+		"casing/.gitignore":     "Upper.TXT\n",
+		"doublestar/.gitignore": "**/gen/**\n",
+	},
+	paths: []string{
+		"a.log", "keep.log", "sub/keep.log", "sub/important.log", "x/y/z.log",
+		"build/", "build/out.bin", "src/build/", "src/build/x",
+		"logs/", "logs/today.txt", "src/logs/", "src/logs/a", "logs2/",
+		"doc/a.pdf", "doc/x/y/b.pdf", "doc/x/b.txt", "other/doc/a.pdf",
+		"cache/", "cache/f", "deep/er/cache/", "deep/er/cache/f", "cachefile",
+		"a/z", "a/b/z", "a/b/c/z", "b/a/z",
+		"tmp1/", "tmp1/f", "tmpfile",
+		"#hash", "!bang", "trailing", "esc ", "esc",
+		"x.o", "x.a", "x.c",
+		"ay.bak", "xy.bak",
+		"file1.txt", "filex.txt",
+		"only/dir/", "only/dir/f", "only/dirfile",
+		"vendor/a/", "vendor/a/f", "vendor/keep/", "vendor/keep/f", "vendor/file",
+		"out/", "out/important.txt",
+		"sub/x.tmp", "sub/inner/x.tmp", "sub/local/", "sub/local/f", "sub/deeper/local/",
+		"sub/nested/deep.txt", "sub/a/nested/deep.txt", "nested/deep.txt",
+		"secret.key", "secret.md", "sub/secret.txt",
+		"x.swp", "sub/.DS_Store",
+		"negated/a.go", "negated/a.txt", "negated/d/", "negated/d/b.go", "negated/d/b.txt",
+		"anch/top.txt", "anch/sub/top.txt", "anch/mid/x.txt", "anch/q/mid/x.txt",
+		"casing/Upper.TXT", "casing/upper.txt",
+		"doublestar/gen/", "doublestar/gen/a", "doublestar/x/gen/b", "doublestar/genx",
+	},
+}
+
+// TestIgnoreMatchesGit compares both engines against `git check-ignore` on
+// the fixture; git is the reference implementation.
+func TestIgnoreMatchesGit(t *testing.T) {
+	root, want := setupIgnoreFixture(t)
+	engines := map[string]Matcher{
+		"builtin": NewIgnore(root, true, nil),
+		"git":     newCheckIgnore(root, nil),
+	}
+	for name, m := range engines {
+		t.Run(name, func(t *testing.T) {
+			defer m.Close()
+			var bad []string
+			for _, p := range ignoreFixture.paths {
+				rel := strings.TrimSuffix(p, "/")
+				if got := m.Ignored(rel, strings.HasSuffix(p, "/")); got != want[rel] {
+					bad = append(bad, rel+": got "+boolWord(got)+", git says "+boolWord(want[rel]))
+				}
+			}
+			sort.Strings(bad)
+			for _, b := range bad {
+				t.Error(b)
+			}
+		})
+	}
+}
+
+// setupIgnoreFixture builds the fixture in a fresh repo, isolated from the
+// user's git config, and returns the paths git reports as ignored.
+func setupIgnoreFixture(t *testing.T) (string, map[string]bool) {
+	t.Helper()
+	root := testutil.NewRepo(t)
+
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		out, err := cmd.Output()
+		if err != nil {
+			if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 1 {
+				t.Fatalf("git %v: %v", args, err)
+			}
+		}
+		return string(out)
+	}
+	git("config", "core.ignorecase", "false")
+	git("config", "core.excludesFile", filepath.Join(root, "global-ignore"))
+
+	write := func(rel, content string) {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for rel, content := range ignoreFixture.files {
+		if rel == "info-exclude" {
+			rel = ".git/info/exclude"
+		}
+		write(rel, content)
+	}
+	for _, rel := range ignoreFixture.paths {
+		if strings.HasSuffix(rel, "/") {
+			if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(rel)), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		write(rel, "x")
+	}
+
+	var paths []string
+	for _, p := range ignoreFixture.paths {
+		paths = append(paths, strings.TrimSuffix(p, "/"))
+	}
+	cmd := exec.Command("git", "check-ignore", "--no-index", "--stdin", "-z")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); !ok || ee.ExitCode() != 1 {
+			t.Fatalf("git check-ignore: %v", err)
+		}
+	}
+	want := map[string]bool{}
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			want[p] = true
+		}
+	}
+
+	return root, want
+}
+
+func TestCheckIgnoreInvalidate(t *testing.T) {
+	root, _ := setupIgnoreFixture(t)
+	c := newCheckIgnore(root, nil)
+	defer c.Close()
+	if c.Ignored("dist/app.js", false) {
+		t.Fatal("dist/app.js ignored before dist/ was added")
+	}
+	f, err := os.OpenFile(filepath.Join(root, ".gitignore"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\ndist/\n")
+	f.Close()
+	os.MkdirAll(filepath.Join(root, "dist"), 0o755)
+	if c.Ignored("dist/app.js", false) {
+		t.Fatal("cached answer changed without Invalidate")
+	}
+	c.Invalidate()
+	if !c.Ignored("dist/app.js", false) {
+		t.Fatal("dist/app.js not ignored after Invalidate")
+	}
+}
+
+func TestCheckIgnoreLargeBatch(t *testing.T) {
+	root, _ := setupIgnoreFixture(t)
+	c := newCheckIgnore(root, nil)
+	defer c.Close()
+	// far more than a pipe buffer in each direction
+	long := strings.Repeat("x", 200)
+	var rels []string
+	for i := range 20000 {
+		rels = append(rels, fmt.Sprintf("d%d/%s%d.log", i%50, long, i), fmt.Sprintf("d%d/%s%d.txt", i%50, long, i))
+	}
+	done := make(chan map[string]bool)
+	go func() { done <- c.Check(rels) }()
+	select {
+	case got := <-done:
+		if len(got) != len(rels) || !got[rels[0]] || got[rels[1]] {
+			t.Errorf("got %d answers; %s → %v, %s → %v", len(got), rels[0], got[rels[0]], rels[1], got[rels[1]])
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Check deadlocked on a large batch")
+	}
+}
+
+func TestIgnoreExcludesWithoutGitignore(t *testing.T) {
+	ig := NewIgnore(t.TempDir(), false, []string{"**/node_modules/**", "*.bak"})
+	cases := map[string]bool{
+		"node_modules/x.js":     true,
+		"a/node_modules/b/c.js": true,
+		"notes.bak":             true,
+		"src/main.go":           false,
+	}
+	for p, want := range cases {
+		if got := ig.Ignored(p, false); got != want {
+			t.Errorf("%s: got %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestNoiseProfiles(t *testing.T) {
+	rc := config.DefaultRepo(t.TempDir())
+	rc.ParseIgnore = false
+	ig := NewMatcher(rc)
+	defer ig.Close()
+	cases := map[string]bool{
+		"src/.main.go.swp":          true,
+		"src/main.go~":              true,
+		"4913":                      true,
+		"docs/.#notes.md":           true,
+		"#notes.md#":                true,
+		"docs/#a.txt#":              true,
+		"docs/#a.txt":               false,
+		"x/.idea/workspace.xml":     true,
+		"x/.idea/misc.xml":          false,
+		"a/b/.DS_Store":             true,
+		"report.docx":               false,
+		"~$report.docx":             true,
+		"main.go___jb_tmp___":       true,
+		"src/main.go":               false,
+		"node_modules/left-pad.js":  true,
+		".history/main_2024.go":     true,
+		"cmd/.history/main_2024.go": true,
+	}
+	for p, want := range cases {
+		if got := ig.Ignored(p, false); got != want {
+			t.Errorf("%s: got %v, want %v", p, got, want)
+		}
+	}
+
+	rc.NoiseProfiles = []string{}
+	off := NewMatcher(rc)
+	defer off.Close()
+	if off.Ignored("src/main.go~", false) {
+		t.Error("noise filtered with noise_profiles: []")
+	}
+}
+
+func TestWildmatch(t *testing.T) {
+	cases := []struct {
+		pat, text string
+		want      bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "a/main.go", false},
+		{"**/a", "a", true},
+		{"**/a", "x/y/a", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "a", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a**b", "a/b", false},
+		{"a**b", "axxb", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "/.txt", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]x", "bx", false},
+		{"[^a-c]x", "dx", true},
+		{"[]]x", "]x", true},
+		{"[[:upper:]]*", "Readme", true},
+		{"\\*x", "*x", true},
+		{"\\*x", "ax", false},
+	}
+	for _, c := range cases {
+		if got := wildmatch(c.pat, c.text); got != c.want {
+			t.Errorf("wildmatch(%q, %q) = %v, want %v", c.pat, c.text, got, c.want)
+		}
+	}
+}
+
+func boolWord(b bool) string {
+	if b {
+		return "ignored"
+	}
+	return "not ignored"
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package watch
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// outOfWatches reports whether err means fs.inotify.max_user_watches is used up.
+func outOfWatches(err error) bool { return errors.Is(err, syscall.ENOSPC) }
+
+// inotifyBudget returns fs.inotify.max_user_watches and how many watches
+// processes of the current user already hold, counted from /proc.
+func inotifyBudget() (limit, used int, ok bool) {
+	b, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0, 0, false
+	}
+	if limit, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+		return 0, 0, false
+	}
+
+	uid := uint32(os.Getuid())
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, p := range procs {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); !ok || st.Uid != uid {
+			continue
+		}
+		fds, _ := os.ReadDir(filepath.Join(p, "fd"))
+		for _, fd := range fds {
+			if target, _ := os.Readlink(filepath.Join(p, "fd", fd.Name())); target != "anon_inode:inotify" {
+				continue
+			}
+			used += countWatches(filepath.Join(p, "fdinfo", fd.Name()))
+		}
+	}
+	return limit, used, true
+}
+
+// countWatches counts the "inotify wd:" lines of an fdinfo file.
+func countWatches(fdinfo string) int {
+	f, err := os.Open(fdinfo)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	n := 0
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if strings.HasPrefix(s.Text(), "inotify wd:") {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watch
+
+// inotifyBudget is unknown off Linux; kqueue and FSEvents limits differ.
+func inotifyBudget() (limit, used int, ok bool) { return 0, 0, false }
+
+// outOfWatches is never reported off Linux.
+func outOfWatches(err error) bool { return false }
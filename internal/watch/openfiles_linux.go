@@ -0,0 +1,54 @@
+//go:build linux
+
+package watch
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// openForWriting returns which of paths (absolute, resolved) another process
+// of the current user holds open for writing, found through /proc/*/fd.
+func openForWriting(paths map[string]string) map[string]bool {
+	open := map[string]bool{}
+	self := strconv.Itoa(os.Getpid())
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, p := range procs {
+		if filepath.Base(p) == self {
+			continue
+		}
+		fds, _ := os.ReadDir(filepath.Join(p, "fd"))
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(p, "fd", fd.Name()))
+			if err != nil {
+				continue
+			}
+			if _, ok := paths[target]; ok && !open[target] && writable(filepath.Join(p, "fdinfo", fd.Name())) {
+				open[target] = true
+			}
+		}
+	}
+	return open
+}
+
+// writable reports whether the "flags:" line of an fdinfo file has a write
+// access mode.
+func writable(fdinfo string) bool {
+	f, err := os.Open(fdinfo)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if v, ok := strings.CutPrefix(s.Text(), "flags:"); ok {
+			flags, err := strconv.ParseUint(strings.TrimSpace(v), 8, 64)
+			return err == nil && flags&syscall.O_ACCMODE != syscall.O_RDONLY
+		}
+	}
+	return false
+}
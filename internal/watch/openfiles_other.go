@@ -0,0 +1,7 @@
+//go:build !linux
+
+package watch
+
+// openForWriting needs /proc; elsewhere only the size and mtime probe of
+// Busy applies.
+func openForWriting(paths map[string]string) map[string]bool { return nil }
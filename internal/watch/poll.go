@@ -0,0 +1,253 @@
+package watch
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/gitops"
+	"github.com/whrit/autoGit/internal/logs"
+)
+
+// DefaultPollInterval applies when poll_interval is unset.
+const DefaultPollInterval = 2 * time.Second
+
+// pollCPUShare bounds polling cost: the pause after a scan is at least this
+// many times the scan's duration, so a slow tree is scanned less often
+// instead of pinning a core.
+const pollCPUShare = 10
+
+// fileState is what a scan remembers per path.
+type fileState struct {
+	size  int64
+	mtime time.Time
+	mode  fs.FileMode
+	code  string // porcelain status, git_status method only
+}
+
+// startPoll watches rc by rescanning it periodically, for filesystems where
+// fsnotify sees nothing (NFS, SMB, sshfs, some bind mounts) or when inotify
+// is exhausted. The "stat" method walks the tree; "git_status" asks git,
+// which is cheaper on large repos but only sees changes git would commit.
+func startPoll(rc config.RepoConfig) (<-chan Batch, func(), error) {
+	ig := NewMatcher(rc)
+	co := newCoalescer(time.Duration(rc.DebounceMS)*time.Millisecond, rc.StormThreshold)
+	p, err := newPoller(rc, ig, co, newDedup(rc.Path), nil)
+	if err != nil {
+		_ = ig.Close()
+		co.close()
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	stop := func() { once.Do(func() { close(p.done) }) }
+	go func() {
+		defer func() { _ = ig.Close(); co.close() }()
+		p.loop()
+	}()
+	return co.out, stop, nil
+}
+
+// newPoller takes the first snapshot of roots, or of the whole repo when
+// roots is empty. Events go to co; the caller runs loop and closes done.
+func newPoller(rc config.RepoConfig, ig Matcher, co *coalescer, dd *dedup, roots []string) (*poller, error) {
+	p := &poller{rc: rc, ig: ig, co: co, dd: dd, roots: roots, done: make(chan struct{}), wake: make(chan struct{}, 1), sources: newStamps(ignoreSources(rc.Path))}
+	if len(p.roots) == 0 {
+		p.roots = []string{rc.Path}
+	}
+	var err error
+	p.snap, err = p.scan()
+	return p, err
+}
+
+type poller struct {
+	rc      config.RepoConfig
+	ig      Matcher
+	co      *coalescer
+	dd      *dedup
+	roots   []string // absolute directories to scan
+	done    chan struct{}
+	sources *stamps
+	snap    map[string]fileState
+
+	mu    sync.Mutex
+	added []string // roots handed over since the last round
+	wake  chan struct{}
+}
+
+// addRoots hands more subtrees to the poller. Their current state becomes
+// the baseline in a round that starts at once.
+func (p *poller) addRoots(dirs []string) {
+	p.mu.Lock()
+	p.added = append(p.added, dirs...)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// adopt takes the roots added since the last round into the snapshot
+// without reporting what they already hold.
+func (p *poller) adopt() {
+	p.mu.Lock()
+	dirs := p.added
+	p.added = nil
+	p.mu.Unlock()
+	if len(dirs) == 0 {
+		return
+	}
+	roots := p.roots
+	p.roots = dirs
+	snap, err := p.scan()
+	p.roots = append(roots, dirs...)
+	if err != nil {
+		log.Printf("[WARN] poll (%s): %v", p.rc.Path, err)
+	}
+	for rel, st := range snap {
+		p.snap[rel] = st
+	}
+}
+
+func (p *poller) loop() {
+	interval := p.rc.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	wait := interval
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(wait):
+		case <-p.wake:
+		}
+		p.adopt()
+		if p.sources.changed() {
+			p.ig.Invalidate()
+		}
+		began := time.Now()
+		next, err := p.scan()
+		if err != nil {
+			log.Printf("[WARN] poll (%s): %v", p.rc.Path, err)
+			wait = interval
+			continue
+		}
+		p.diff(next)
+		wait = interval
+		if d := time.Since(began) * pollCPUShare; d > wait {
+			wait = d
+		}
+	}
+}
+
+// diff emits an event for every path that appeared, changed or vanished.
+func (p *poller) diff(next map[string]fileState) {
+	reload := false
+	for rel, st := range next {
+		old, ok := p.snap[rel]
+		switch {
+		case !ok:
+			p.dd.changed(rel)
+			p.co.add(rel, Create)
+		case (st.size != old.size || !st.mtime.Equal(old.mtime) || st.mode != old.mode) && st.code == old.code && !p.dd.changed(rel):
+			logs.Debugf("no-op write on %s (%s)", rel, p.rc.Path)
+			p.co.suppress()
+			continue
+		case st.size != old.size || !st.mtime.Equal(old.mtime) || st.code != old.code:
+			p.co.add(rel, Write)
+		case st.mode != old.mode:
+			p.co.add(rel, Chmod)
+		default:
+			continue
+		}
+		reload = reload || filepath.Base(rel) == ".gitignore"
+	}
+	for rel := range p.snap {
+		if _, ok := next[rel]; !ok {
+			p.dd.forget(rel)
+			p.co.add(rel, Remove)
+			reload = reload || filepath.Base(rel) == ".gitignore"
+		}
+	}
+	p.snap = next
+	if reload {
+		p.ig.Invalidate()
+	}
+}
+
+func (p *poller) scan() (map[string]fileState, error) {
+	if p.rc.PollMethod == "git_status" {
+		return p.scanStatus()
+	}
+	return p.scanTree()
+}
+
+func (p *poller) scanTree() (map[string]fileState, error) {
+	snap := map[string]fileState{}
+	for _, root := range p.roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == p.rc.Path {
+					return err
+				}
+				return nil
+			}
+			rel := relPath(p.rc.Path, path)
+			if d.IsDir() {
+				if path != p.rc.Path && (d.Name() == ".git" || nestedRepo(path) || p.ig.Ignored(rel, true)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if p.ig.Ignored(rel, false) {
+				return nil
+			}
+			if fi, err := d.Info(); err == nil {
+				snap[rel] = fileState{size: fi.Size(), mtime: fi.ModTime(), mode: fi.Mode()}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// covers reports whether rel lies under one of the polled roots.
+func (p *poller) covers(rel string) bool {
+	for _, root := range p.roots {
+		r := relPath(p.rc.Path, root)
+		if r == "." || rel == r || strings.HasPrefix(rel, r+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// scanStatus only looks at dirty paths; a path returning to its committed
+// state shows up as removed from the snapshot, which is still a change.
+func (p *poller) scanStatus() (map[string]fileState, error) {
+	dirty, err := gitops.StatusPaths(p.rc.Path)
+	if err != nil {
+		return nil, err
+	}
+	snap := make(map[string]fileState, len(dirty))
+	for rel, code := range dirty {
+		if strings.HasSuffix(rel, "/") || !p.covers(rel) || p.ig.Ignored(rel, false) {
+			continue
+		}
+		st := fileState{code: code}
+		if fi, err := os.Lstat(filepath.Join(p.rc.Path, filepath.FromSlash(rel))); err == nil {
+			st.size, st.mtime, st.mode = fi.Size(), fi.ModTime(), fi.Mode()
+		}
+		snap[rel] = st
+	}
+	return snap, nil
+}
@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestPollDetectsChanges(t *testing.T) {
+	for _, method := range []string{"stat", "git_status"} {
+		t.Run(method, func(t *testing.T) {
+			root := testutil.NewRepo(t)
+			write := func(rel, s string) {
+				if err := os.WriteFile(filepath.Join(root, rel), []byte(s), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			write(".gitignore", "*.log\n")
+			write("keep.txt", "a")
+			write("gone.txt", "a")
+
+			rc := config.DefaultRepo(root)
+			rc.WatchBackend, rc.PollMethod = "poll", method
+			rc.PollInterval, rc.DebounceMS = 20*time.Millisecond, 10
+			ch, stop, err := Start(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+
+			write("keep.txt", "changed")
+			write("new.txt", "b")
+			write("noise.log", "x")
+			os.Remove(filepath.Join(root, "gone.txt"))
+
+			want := map[string]Op{"keep.txt": Write, "new.txt": Create, "gone.txt": Remove}
+			var got Batch
+			deadline := time.After(2 * time.Second)
+			for len(got.Paths) < len(want) {
+				select {
+				case b := <-ch:
+					got.Merge(b)
+				case <-deadline:
+					t.Fatalf("timed out; got %v", got.Paths)
+				}
+			}
+			for p, op := range want {
+				if got.Paths[p] != op {
+					t.Errorf("%s: op %v, want %v (all: %v)", p, got.Paths[p], op, got.Paths)
+				}
+			}
+			if _, ok := got.Paths["noise.log"]; ok {
+				t.Error("ignored noise.log reported")
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package watch
+
+import (
+	"path"
+	"strings"
+)
+
+// scope narrows a Matcher to the paths matched by include globs: anything
+// outside them counts as ignored, and directories that can't contain an
+// included path aren't descended into. Globs use gitignore syntax; one
+// without a slash matches a name at any depth, and a glob matching a
+// directory includes everything below it.
+type scope struct {
+	Matcher
+	includes []include
+}
+
+type include struct {
+	pat      string
+	anchored bool // had a slash, so it matches from the root only
+}
+
+func newScope(m Matcher, includes []string) Matcher {
+	s := &scope{Matcher: m}
+	for _, inc := range includes {
+		inc = strings.TrimSuffix(strings.TrimSpace(inc), "/")
+		if pat := strings.TrimPrefix(inc, "/"); pat != "" {
+			s.includes = append(s.includes, include{pat: pat, anchored: strings.Contains(inc, "/")})
+		}
+	}
+	if len(s.includes) == 0 {
+		return m
+	}
+	return s
+}
+
+func (s *scope) Ignored(rel string, isDir bool) bool {
+	rel = cleanRel(rel)
+	if rel == "" {
+		return false
+	}
+	if !s.included(rel) && !(isDir && s.reaches(rel)) {
+		return true
+	}
+	return s.Matcher.Ignored(rel, isDir)
+}
+
+// included reports whether rel or one of its parents matches an include.
+func (s *scope) included(rel string) bool {
+	for p := rel; p != "."; p = path.Dir(p) {
+		for _, inc := range s.includes {
+			if !inc.anchored {
+				if wildmatch(inc.pat, path.Base(p)) {
+					return true
+				}
+			} else if wildmatch(inc.pat, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reaches reports whether an include could match something below dir.
+func (s *scope) reaches(dir string) bool {
+	parts := strings.Split(dir, "/")
+	for _, inc := range s.includes {
+		if !inc.anchored {
+			return true
+		}
+		pat := strings.Split(inc.pat, "/")
+		ok := true
+		for i, d := range parts {
+			if i >= len(pat)-1 || pat[i] == "**" {
+				ok = i < len(pat) && pat[i] == "**"
+				break
+			}
+			if !wildmatch(pat[i], d) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether rel, or a directory above it, matches one of globs
+// the way includes do.
+func Matches(globs []string, rel string) bool {
+	s, ok := newScope(nil, globs).(*scope)
+	return ok && s.included(cleanRel(rel))
+}
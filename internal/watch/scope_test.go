@@ -0,0 +1,40 @@
+package watch
+
+import "testing"
+
+func TestScope(t *testing.T) {
+	s := newScope(NewIgnore(t.TempDir(), false, []string{"*.log"}), []string{"services/payments/**", "docs/", "/README.md", "*.proto"})
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool // ignored
+	}{
+		{"services", true, false},
+		{"services/payments", true, false},
+		{"services/payments/api/v1", true, false},
+		{"services/payments/api/v1/handler.go", false, false},
+		{"services/payments/debug.log", false, true},
+		{"services/ledger", true, false}, // *.proto may match below
+		{"services/ledger/main.go", false, true},
+		{"docs", true, false},
+		{"docs/guide/intro.md", false, false},
+		{"README.md", false, false},
+		{"cmd/README.md", false, true},
+		{"cmd/api.proto", false, false},
+		{"main.go", false, true},
+	}
+	for _, c := range cases {
+		if got := s.Ignored(c.rel, c.isDir); got != c.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+
+	anchored := newScope(NewIgnore(t.TempDir(), false, nil), []string{"services/payments/**"})
+	if !anchored.Ignored("services/ledger", true) || !anchored.Ignored("docs", true) {
+		t.Error("directories outside anchored includes are descended into")
+	}
+
+	if m := newScope(NewIgnore(t.TempDir(), false, nil), nil); m.Ignored("main.go", false) {
+		t.Error("no includes should include everything")
+	}
+}
@@ -0,0 +1,189 @@
+package watch
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// tree tracks the directories registered with fsnotify so watches can be
+// added and removed incrementally when the ignore rules change.
+type tree struct {
+	root string
+	w    *fsnotify.Watcher
+	ig   Matcher
+
+	mu      sync.Mutex
+	watched map[string]bool
+	polled  map[string]bool // subtrees left to the poller for lack of watches
+
+	// spill takes the subtrees add couldn't watch because the inotify
+	// watches ran out; without it add fails instead.
+	spill func(dirs []string)
+}
+
+// watchAdd registers one directory; tests swap it to run out of watches.
+var watchAdd = (*fsnotify.Watcher).Add
+
+func newTree(root string, w *fsnotify.Watcher, ig Matcher) *tree {
+	return &tree{root: root, w: w, ig: ig, watched: map[string]bool{}, polled: map[string]bool{}}
+}
+
+// watchOnly registers exactly dirs, without descending, and hands the polled
+// subtrees to the poller for good. Directories that find the inotify watches
+// used up are polled too and returned as spilled.
+func (t *tree) watchOnly(dirs, polled []string) (spilled []string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, d := range polled {
+		t.polled[d] = true
+	}
+	for _, d := range dirs {
+		if t.underPolled(d) {
+			continue
+		}
+		if err := watchAdd(t.w, d); err != nil {
+			if !outOfWatches(err) {
+				return spilled, err
+			}
+			t.polled[d] = true
+			spilled = append(spilled, d)
+			continue
+		}
+		t.watched[d] = true
+	}
+	return spilled, nil
+}
+
+// underPolled reports whether path lies in a polled subtree; callers hold mu.
+func (t *tree) underPolled(path string) bool {
+	for p := path; ; p = filepath.Dir(p) {
+		if t.polled[p] {
+			return true
+		}
+		if p == t.root || p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+// add watches dir and every directory below it that isn't ignored. Subtrees
+// that find the inotify watches used up go to spill.
+func (t *tree) add(dir string) (added int, err error) {
+	var spilled []string
+	t.mu.Lock()
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir {
+				return nil // vanished while walking
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" || t.polled[path] || (path != t.root && nestedRepo(path)) || t.ig.Ignored(relPath(t.root, path), true) {
+			return filepath.SkipDir
+		}
+		if t.watched[path] {
+			return nil
+		}
+		if err := watchAdd(t.w, path); err != nil {
+			if t.spill == nil || !outOfWatches(err) {
+				return err
+			}
+			t.polled[path] = true
+			spilled = append(spilled, path)
+			return filepath.SkipDir
+		}
+		t.watched[path] = true
+		added++
+		return nil
+	})
+	t.mu.Unlock()
+	if len(spilled) > 0 {
+		t.spill(spilled)
+	}
+	return added, err
+}
+
+// forget drops path and everything below it after it was removed or renamed
+// away; the kernel has already released those watches.
+func (t *tree) forget(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prefix := path + string(filepath.Separator)
+	for d := range t.watched {
+		if d == path || strings.HasPrefix(d, prefix) {
+			delete(t.watched, d)
+		}
+	}
+}
+
+// prune removes the watches on dir and below, e.g. once it turned out to be
+// another repository.
+func (t *tree) prune(dir string) (removed int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prefix := dir + string(filepath.Separator)
+	for d := range t.watched {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			_ = t.w.Remove(d)
+			delete(t.watched, d)
+			removed++
+		}
+	}
+	return removed
+}
+
+// resync applies changed ignore rules: watches on newly ignored directories
+// are removed and newly unignored directories are added.
+func (t *tree) resync() (added, removed int, err error) {
+	t.mu.Lock()
+	dirs := make([]string, 0, len(t.watched))
+	for d := range t.watched {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		if d != t.root && t.ig.Ignored(relPath(t.root, d), true) {
+			_ = t.w.Remove(d)
+			delete(t.watched, d)
+			removed++
+		}
+	}
+	t.mu.Unlock()
+
+	added, err = t.add(t.root)
+	return added, removed, err
+}
+
+// reset moves every watch onto a fresh fsnotify watcher after the old one
+// failed, keeping the polled subtrees as they were. The old one is closed.
+func (t *tree) reset(w *fsnotify.Watcher) (added int, err error) {
+	t.mu.Lock()
+	old := t.w
+	t.w = w
+	t.watched = map[string]bool{}
+	t.mu.Unlock()
+	_ = old.Close()
+	return t.add(t.root)
+}
+
+// close releases the current fsnotify watcher.
+func (t *tree) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.w.Close()
+}
+
+// size is the number of directories being watched.
+func (t *tree) size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.watched)
+}
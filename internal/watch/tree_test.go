@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestTreeResyncFollowsIgnoreChanges(t *testing.T) {
+	root := testutil.NewRepo(t)
+	for _, d := range []string{"src", "dist/js", "build"} {
+		os.MkdirAll(filepath.Join(root, d), 0o755)
+	}
+	writeIgnore := func(s string) {
+		if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIgnore("build/\n")
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ig := NewIgnore(root, true, nil)
+	tr := newTree(root, w, ig)
+	if _, err := tr.add(root); err != nil {
+		t.Fatal(err)
+	}
+	watched := func(rel string) bool { return tr.watched[filepath.Join(root, rel)] }
+	if !watched("dist/js") || watched("build") {
+		t.Fatalf("initial watches wrong: %v", tr.watched)
+	}
+
+	writeIgnore("dist/\n")
+	ig.Invalidate()
+	added, removed, err := tr.resync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || removed != 2 {
+		t.Errorf("resync = +%d/-%d, want +1/-2", added, removed)
+	}
+	if watched("dist") || watched("dist/js") || !watched("build") || !watched("src") {
+		t.Errorf("watches after resync wrong: %v", tr.watched)
+	}
+}
+
+func TestOutOfWatchesFallsBackToPolling(t *testing.T) {
+	if !outOfWatches(syscall.ENOSPC) {
+		t.Skip("inotify only")
+	}
+	root := testutil.NewRepo(t)
+	// directories named big* find the watches used up
+	add := watchAdd
+	watchAdd = func(w *fsnotify.Watcher, dir string) error {
+		if strings.HasPrefix(filepath.Base(dir), "big") {
+			return syscall.ENOSPC
+		}
+		return add(w, dir)
+	}
+	t.Cleanup(func() { watchAdd = add })
+	os.MkdirAll(filepath.Join(root, "big1", "sub"), 0o755)
+
+	rc := config.DefaultRepo(root)
+	rc.DebounceMS, rc.PollInterval = 10, 50*time.Millisecond
+	ch, stop, err := startNotify(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	expect := func(rel string) {
+		t.Helper()
+		deadline := time.After(3 * time.Second)
+		for {
+			select {
+			case b := <-ch:
+				if _, ok := b.Paths[rel]; ok {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("no event for %s", rel)
+			}
+		}
+	}
+
+	// spilled at startup
+	os.WriteFile(filepath.Join(root, "big1", "sub", "a.txt"), []byte("a"), 0o644)
+	expect("big1/sub/a.txt")
+
+	// spilled when created later
+	os.MkdirAll(filepath.Join(root, "big2"), 0o755)
+	time.Sleep(300 * time.Millisecond)
+	os.WriteFile(filepath.Join(root, "big2", "b.txt"), []byte("b"), 0o644)
+	expect("big2/b.txt")
+
+	// the rest is still watched
+	os.WriteFile(filepath.Join(root, "c.txt"), []byte("c"), 0o644)
+	expect("c.txt")
+}
@@ -1,8 +1,9 @@
 package watch
 
 import (
-	"bufio"
+	"errors"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,144 +12,409 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/gitops"
+	"github.com/whrit/autoGit/internal/logs"
 )
 
-// Start begins watching a repo and returns a channel of changed file paths and a stop func.
-func Start(rc config.RepoConfig) (<-chan string, func(), error) {
+// Start begins watching a repo and returns a channel of change batches and a
+// stop func. The channel is closed once the watcher stops; stop may be called
+// more than once. rc.WatchBackend picks fsnotify, polling, or fsnotify with
+// a fallback to polling ("auto").
+func Start(rc config.RepoConfig) (<-chan Batch, func(), error) {
+	switch rc.WatchBackend {
+	case "poll":
+		return startPoll(rc)
+	case "auto":
+		ch, stop, err := startNotify(rc)
+		if err == nil {
+			return ch, stop, nil
+		}
+		log.Printf("[WARN] fsnotify unavailable (%s): %v; falling back to polling", rc.Path, err)
+		return startPoll(rc)
+	default:
+		return startNotify(rc)
+	}
+}
+
+func startNotify(rc config.RepoConfig) (<-chan Batch, func(), error) {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	changes := make(chan string, 128)
-	stop := func() { _ = w.Close(); close(changes) }
+	// custom excludes plus gitignore rules
+	ig := NewMatcher(rc)
 
-	// merge excludes with .gitignore patterns (basic)
-	excludes := append([]string{}, rc.Excludes...)
-	if rc.ParseIgnore {
-		excludes = append(excludes, readGitignore(rc.Path)...)
+	// debounce to coalesce flurries of events
+	co := newCoalescer(time.Duration(rc.DebounceMS)*time.Millisecond, rc.StormThreshold)
+	t := newTree(rc.Path, w, ig)
+	dd := newDedup(rc.Path)
+	var (
+		pl       *poller
+		plMu     sync.Mutex // pl may start late, when watches run out
+		plClosed bool
+	)
+	cleanup := func() {
+		plMu.Lock()
+		if pl != nil {
+			close(pl.done)
+		}
+		plClosed = true
+		plMu.Unlock()
+		_ = t.close()
+		_ = ig.Close()
+		co.close()
 	}
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() { once.Do(func() { close(done) }) }
 
-	addDir := func(path string) error {
-		base := filepath.Base(path)
-		if strings.HasPrefix(base, ".git") {
-			return filepath.SkipDir
+	dirs, err := scanDirs(rc.Path, ig)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	// with too few inotify watches left, the most recently modified subtrees
+	// get watches and the rest is polled
+	watchDirs, polled := dirs.all(nil), []string(nil)
+	if limit, used, ok := inotifyBudget(); ok {
+		if free := limit - used - limit/20; dirs.count > free {
+			watchDirs, polled = planWatches(dirs, free)
+			log.Printf("[WARN] %s needs %d inotify watches but only %d are free; watching %d dirs and polling %d subtree(s). To watch everything, %s",
+				rc.Path, dirs.count, max(free, 0), len(watchDirs), len(polled), limitAdvice(limit, used, dirs.count))
 		}
-		if shouldExclude(path, rc.Path, excludes) {
-			return filepath.SkipDir
+	}
+	spilled, err := t.watchOnly(watchDirs, polled)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	polled = append(polled, spilled...)
+	if len(polled) > 0 {
+		if pl, err = newPoller(rc, ig, co, dd, polled); err != nil {
+			pl = nil
+			cleanup()
+			return nil, nil, err
 		}
-		return w.Add(path)
+		go pl.loop()
 	}
+	log.Printf("[INFO] watching %s: %d inotify watches, %d polled subtree(s)", rc.Path, t.size(), len(polled))
 
-	if err := filepath.WalkDir(rc.Path, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+	// directories added later that find the watches used up are polled
+	// like the subtrees left over at startup
+	t.spill = func(dirs []string) {
+		advice := "free some inotify watches"
+		if limit, used, ok := inotifyBudget(); ok {
+			advice = limitAdvice(limit, used, len(dirs))
 		}
-		if d.IsDir() {
-			return addDir(path)
+		log.Printf("[WARN] out of inotify watches (%s); polling %d more subtree(s). To watch everything, %s", rc.Path, len(dirs), advice)
+		plMu.Lock()
+		defer plMu.Unlock()
+		switch {
+		case plClosed:
+			return
+		case pl != nil:
+			pl.addRoots(dirs)
+			return
 		}
-		return nil
-	}); err != nil {
-		_ = w.Close()
-		return nil, nil, err
+		p, err := newPoller(rc, ig, co, dd, dirs)
+		if err != nil {
+			log.Printf("[WARN] cannot poll (%s): %v", rc.Path, err)
+			return
+		}
+		pl = p
+		go pl.loop()
 	}
 
-	// debounce to coalesce flurries of events
-	debounce := time.Duration(rc.DebounceMS) * time.Millisecond
-	var mu sync.Mutex
-	var timer *time.Timer
-	var last string
+	// ignore rules are reloaded live: .gitignore edits arrive as events,
+	// info/exclude and core.excludesFile are polled
+	sources := newStamps(ignoreSources(rc.Path))
+	sourceTicker := time.NewTicker(sourcePoll)
+	var reloadTimer *time.Timer
+	reload := func() {
+		ig.Invalidate()
+		if reloadTimer != nil {
+			reloadTimer.Stop()
+		}
+		reloadTimer = time.AfterFunc(reloadDelay, func() {
+			added, removed, err := t.resync()
+			if err != nil {
+				log.Printf("[WARN] watch resync (%s): %v", rc.Path, err)
+			}
+			if added > 0 || removed > 0 {
+				log.Printf("[INFO] ignore rules changed (%s): +%d/-%d watched dirs, %d total", rc.Path, added, removed, t.size())
+			}
+		})
+	}
 
-	fire := func() {
-		mu.Lock()
-		f := last
-		last = ""
-		mu.Unlock()
-		if f != "" {
-			changes <- f
+	// the watcher only ends when stopped: an overflow triggers a rescan, any
+	// other error a fresh fsnotify watcher, retried with backoff
+	backoff, restarted := restartMin, time.Time{}
+	restart := func(cause error) *fsnotify.Watcher {
+		if time.Since(restarted) > restartMax {
+			backoff = restartMin
+		}
+		log.Printf("[WARN] watcher failed (%s): %v; restarting in %s", rc.Path, cause, backoff)
+		for {
+			select {
+			case <-done:
+				return nil
+			case <-time.After(backoff):
+			}
+			restarted = time.Now()
+			nw, err := fsnotify.NewWatcher()
+			if err == nil {
+				if _, err = t.reset(nw); err == nil {
+					log.Printf("[INFO] watcher restarted (%s): %d inotify watches", rc.Path, t.size())
+					return nw
+				}
+			}
+			backoff = min(backoff*2, restartMax)
+			log.Printf("[WARN] watcher restart (%s): %v; retrying in %s", rc.Path, err, backoff)
 		}
 	}
 
-	reset := func(f string) {
-		mu.Lock()
-		last = f
-		mu.Unlock()
-		if timer != nil {
-			timer.Stop()
+	var (
+		renamed   string // last path renamed away, waiting for its new name
+		renamedAt time.Time
+	)
+	// handle turns one event into coalescer input
+	handle := func(ev fsnotify.Event) {
+		if strings.Contains(ev.Name, string(os.PathSeparator)+".git"+string(os.PathSeparator)) {
+			return
+		}
+		if filepath.Base(ev.Name) == ".git" {
+			// a clone or git init below the root is another repository
+			if dir := filepath.Dir(ev.Name); dir != rc.Path && ev.Op&fsnotify.Create != 0 {
+				t.prune(dir)
+				log.Printf("[INFO] nested repository appeared (%s): %s is no longer watched", rc.Path, relPath(rc.Path, dir))
+			}
+			return
+		}
+		if filepath.Base(ev.Name) == ".gitignore" {
+			reload()
+		}
+		if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+			t.forget(ev.Name)
+		}
+		fi, statErr := os.Lstat(ev.Name)
+		isDir := statErr == nil && fi.IsDir()
+		if ig.Ignored(relPath(rc.Path, ev.Name), isDir) {
+			return
+		}
+		if ev.Op&fsnotify.Create == fsnotify.Create && isDir {
+			if _, err := t.add(ev.Name); err != nil {
+				log.Printf("[WARN] cannot watch %s: %v", ev.Name, err)
+			}
+		}
+		rel := relPath(rc.Path, ev.Name)
+		switch {
+		case ev.Op&fsnotify.Create != 0 && renamed != "" && time.Since(renamedAt) < pairWindow:
+			// the kernel reports a move as Rename of the old name
+			// immediately followed by Create of the new one
+			dd.changed(rel)
+			co.move(renamed, rel)
+			renamed = ""
+		case ev.Op&fsnotify.Rename != 0:
+			dd.forget(rel)
+			co.add(rel, opOf(ev.Op))
+			renamed, renamedAt = rel, time.Now()
+		case ev.Op&fsnotify.Remove != 0:
+			dd.forget(rel)
+			co.add(rel, opOf(ev.Op))
+		case !isDir && !dd.changed(rel):
+			logs.Debugf("no-op %s on %s (%s)", strings.ToLower(ev.Op.String()), rel, rc.Path)
+			co.suppress()
+		default:
+			co.add(rel, opOf(ev.Op))
 		}
-		timer = time.AfterFunc(debounce, fire)
 	}
 
 	go func() {
-		defer stop()
+		defer cleanup()
+		defer sourceTicker.Stop()
 		for {
 			select {
+			case <-done:
+				return
 			case ev, ok := <-w.Events:
 				if !ok {
-					return
-				}
-				if strings.Contains(ev.Name, string(os.PathSeparator)+".git"+string(os.PathSeparator)) {
+					if w = restart(errors.New("event channel closed")); w == nil {
+						return
+					}
+					rescan(rc, t, ig, co)
 					continue
 				}
-				if shouldExclude(ev.Name, rc.Path, excludes) {
-					continue
+				evs := []fsnotify.Event{ev}
+			drain:
+				for len(evs) < prefetchMax {
+					select {
+					case ev, ok := <-w.Events:
+						if !ok {
+							break drain
+						}
+						evs = append(evs, ev)
+					default:
+						break drain
+					}
 				}
-				if ev.Op&fsnotify.Create == fsnotify.Create {
-					if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
-						_ = addDir(ev.Name)
+				// whatever else is queued is checked against the ignore
+				// rules in one go
+				var rels []string
+				for _, ev := range evs {
+					if rel := relPath(rc.Path, ev.Name); rel != ".git" && !strings.HasPrefix(rel, ".git/") {
+						rels = append(rels, rel)
 					}
 				}
-				reset(ev.Name)
-			case err := <-w.Errors:
-				_ = err // ignore but keep loop; stop() will be deferred on return
-				return
+				prefetch(ig, rels)
+				for _, ev := range evs {
+					handle(ev)
+				}
+			case <-sourceTicker.C:
+				if sources.changed() {
+					reload()
+				}
+			case err, ok := <-w.Errors:
+				if ok && errors.Is(err, fsnotify.ErrEventOverflow) {
+					log.Printf("[WARN] event queue overflowed (%s); rescanning", rc.Path)
+					rescan(rc, t, ig, co)
+					continue
+				}
+				if !ok {
+					err = errors.New("error channel closed")
+				}
+				if w = restart(err); w == nil {
+					return
+				}
+				rescan(rc, t, ig, co)
 			}
 		}
 	}()
 
-	return changes, stop, nil
+	return co.out, stop, nil
 }
 
-func readGitignore(root string) []string {
-	f, err := os.Open(filepath.Join(root, ".gitignore"))
+// prefetchMax bounds how many queued events are taken at once.
+const prefetchMax = 256
+
+// pairWindow is how soon after a Rename the Create of the new name must
+// arrive for the two to count as one move.
+const pairWindow = 100 * time.Millisecond
+
+// Restart backoff for a failed fsnotify watcher.
+const (
+	restartMin = time.Second
+	restartMax = time.Minute
+)
+
+// rescan recovers from lost events: directories created meanwhile get
+// watches, and every dirty path is delivered at once as a Rescan batch since
+// which of them changed can't be known.
+func rescan(rc config.RepoConfig, t *tree, ig Matcher, co *coalescer) {
+	if _, _, err := t.resync(); err != nil {
+		log.Printf("[WARN] watch resync (%s): %v", rc.Path, err)
+	}
+	b, err := dirty(rc, ig)
 	if err != nil {
-		return nil
+		log.Printf("[WARN] rescan (%s): %v", rc.Path, err)
+		return
 	}
-	defer f.Close()
-	var pats []string
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		line := strings.TrimSpace(s.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		pats = append(pats, line)
+	if b.Empty() {
+		return
 	}
-	return pats
+	b.Rescan = true
+	co.emit(b)
+}
+
+// nestedRepo reports whether dir is the top of another repository: a clone,
+// worktree or submodule, where .git may also be a file.
+func nestedRepo(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
 }
 
-func shouldExclude(p, root string, globs []string) bool {
-	rel, _ := filepath.Rel(root, p)
-	for _, g := range globs {
-		if matchGlob(g, rel) {
-			return true
+// NestedRepos lists the repositories below rc.Path that aren't ignored,
+// without descending into them.
+func NestedRepos(rc config.RepoConfig) ([]string, error) {
+	ig := NewMatcher(rc)
+	defer ig.Close()
+	var found []string
+	err := filepath.WalkDir(rc.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == rc.Path {
+				return err
+			}
+			return nil
 		}
-	}
-	return false
+		if !d.IsDir() || path == rc.Path {
+			return nil
+		}
+		if d.Name() == ".git" || ig.Ignored(relPath(rc.Path, path), true) {
+			return filepath.SkipDir
+		}
+		if nestedRepo(path) {
+			found = append(found, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found, err
+}
+
+// Dirty returns a batch of every path git status reports in rc's scope, for
+// catching up on changes made while nothing was watching.
+func Dirty(rc config.RepoConfig) (Batch, error) {
+	ig := NewMatcher(rc)
+	defer ig.Close()
+	return dirty(rc, ig)
 }
 
-func matchGlob(pattern, s string) bool {
-	if ok, _ := filepath.Match(pattern, s); ok {
-		return true
+func dirty(rc config.RepoConfig, ig Matcher) (Batch, error) {
+	paths, err := gitops.StatusPaths(rc.Path)
+	if err != nil {
+		return Batch{}, err
 	}
-	if !strings.Contains(pattern, "**") {
-		return false
+	rels := make([]string, 0, len(paths))
+	for rel := range paths {
+		if !strings.HasSuffix(rel, "/") {
+			rels = append(rels, rel)
+		}
 	}
-	parts := strings.Split(pattern, "**")
-	if len(parts) == 2 {
-		pre := strings.TrimSuffix(parts[0], string(os.PathSeparator))
-		suf := strings.TrimPrefix(parts[1], string(os.PathSeparator))
-		return strings.HasPrefix(s, pre) && strings.HasSuffix(s, suf)
+	prefetch(ig, rels)
+	var b Batch
+	now := time.Now()
+	for rel, code := range paths {
+		if strings.HasSuffix(rel, "/") {
+			continue // an untracked nested repository
+		}
+		if !ig.Ignored(rel, false) {
+			b.add(rel, statusOp(code), now)
+		}
+	}
+	return b, nil
+}
+
+// statusOp maps a porcelain status code to the closest Op.
+func statusOp(code string) Op {
+	switch {
+	case code == "??" || strings.ContainsRune(code, 'A'):
+		return Create
+	case strings.ContainsRune(code, 'D'):
+		return Remove
+	case strings.ContainsRune(code, 'R'):
+		return Rename
+	}
+	return Write
+}
+
+// reloadDelay lets a burst of ignore-file edits settle before re-walking.
+const reloadDelay = 300 * time.Millisecond
+
+// relPath makes p relative to root with forward slashes.
+func relPath(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
 	}
-	return false
+	return filepath.ToSlash(rel)
 }
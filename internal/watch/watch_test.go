@@ -0,0 +1,148 @@
+package watch
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/whrit/autoGit/internal/config"
+	"github.com/whrit/autoGit/internal/testutil"
+)
+
+func TestRescanAfterLostEvents(t *testing.T) {
+	root := testutil.NewRepo(t)
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\n"), 0o644)
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ig := NewIgnore(root, true, nil)
+	tr := newTree(root, w, ig)
+	defer tr.close()
+	if _, err := tr.add(root); err != nil {
+		t.Fatal(err)
+	}
+	co := newCoalescer(time.Hour, 0)
+	defer co.close()
+
+	// changes made while no events arrive
+	os.MkdirAll(filepath.Join(root, "sub"), 0o755)
+	os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(root, "noise.log"), []byte("x"), 0o644)
+
+	rescan(config.DefaultRepo(root), tr, ig, co)
+	select {
+	case b := <-co.out:
+		if !b.Rescan {
+			t.Error("batch not marked as rescan")
+		}
+		if b.Paths["sub/a.txt"] != Create || b.Paths[".gitignore"] != Create {
+			t.Errorf("paths = %v", b.Paths)
+		}
+		if _, ok := b.Paths["noise.log"]; ok {
+			t.Error("ignored path delivered")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no rescan batch")
+	}
+	if tr.size() != 2 {
+		t.Errorf("watching %d dirs, want 2", tr.size())
+	}
+
+	// a replaced watcher takes over every watch
+	nw, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.reset(nw); err != nil || tr.size() != 2 {
+		t.Errorf("reset: %d dirs, %v", tr.size(), err)
+	}
+}
+
+func TestWatcherPairsMoves(t *testing.T) {
+	root := testutil.NewRepo(t)
+	os.WriteFile(filepath.Join(root, "old.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(root, "doc.txt"), []byte("a"), 0o644)
+
+	rc := config.DefaultRepo(root)
+	rc.WatchBackend, rc.DebounceMS = "fsnotify", 50
+	ch, stop, err := Start(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	os.Rename(filepath.Join(root, "old.txt"), filepath.Join(root, "new.txt"))
+	tmp := filepath.Join(root, ".doc.txt.swp1")
+	os.WriteFile(tmp, []byte("b"), 0o644)
+	os.Rename(tmp, filepath.Join(root, "doc.txt"))
+
+	var got Batch
+	deadline := time.After(2 * time.Second)
+	for got.Paths["doc.txt"] == 0 || got.Renames["old.txt"] == "" {
+		select {
+		case b := <-ch:
+			got.Merge(b)
+		case <-deadline:
+			t.Fatalf("timed out; got %v %v", got.Paths, got.Renames)
+		}
+	}
+	if got.Paths["doc.txt"] != Write {
+		t.Errorf("doc.txt = %v, want write", got.Paths["doc.txt"])
+	}
+	if _, ok := got.Paths[".doc.txt.swp1"]; ok {
+		t.Error("temp file leaked into batch")
+	}
+	if got.Renames["old.txt"] != "new.txt" {
+		t.Errorf("renames = %v", got.Renames)
+	}
+}
+
+func TestNestedReposAreNotWatched(t *testing.T) {
+	root := testutil.NewRepo(t)
+	for _, dir := range []string{filepath.Join(root, "vendor", "lib"), filepath.Join(root, "ignored", "repo")} {
+		if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+			t.Fatalf("git init: %v %s", err, out)
+		}
+	}
+	os.MkdirAll(filepath.Join(root, "vendor", "lib", "src"), 0o755)
+	os.WriteFile(filepath.Join(root, "vendor", "lib", "a.go"), []byte("package lib"), 0o644)
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("ignored/\n"), 0o644)
+
+	rc := config.DefaultRepo(root)
+	found, err := NestedRepos(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "vendor", "lib"); len(found) != 1 || found[0] != want {
+		t.Errorf("NestedRepos = %v, want [%s]", found, want)
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ig := NewMatcher(rc)
+	tr := newTree(root, w, ig)
+	defer tr.close()
+	if _, err := tr.add(root); err != nil {
+		t.Fatal(err)
+	}
+	if tr.size() != 2 { // root and vendor
+		t.Errorf("watching %d dirs, want 2", tr.size())
+	}
+	b, err := dirty(rc, ig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range b.Paths {
+		if strings.HasPrefix(p, "vendor/") {
+			t.Errorf("nested repo path %s reported dirty", p)
+		}
+	}
+}